@@ -0,0 +1,124 @@
+package oci8
+
+/*
+#include <oci.h>
+*/
+import "C"
+
+import (
+	"database/sql/driver"
+
+	"golang.org/x/net/context"
+)
+
+// callState is the state of the round trips of a connection.
+type callState int
+
+const (
+	callIdle     callState = iota // no call in flight
+	callInFlight                  // a call is in flight, OCIBreak may cancel it
+	callBroken                    // OCIBreak was sent, OCIReset is due
+)
+
+// call is a round trip of a connection, which the context it is made with
+// may cancel. See OCI8Conn.startCall.
+type call struct {
+	c        *OCI8Conn
+	ctx      context.Context
+	deadline bool          // the call timeout is the deadline of ctx
+	done     chan struct{} // closed by finish
+	stopped  chan struct{} // closed when the watch of ctx returned
+}
+
+// startCall waits for the call in flight on c to finish, sets the call
+// timeout for ctx and starts a call, which is broken by OCIBreak when ctx is
+// done before finish. Only one call is in flight on c at a time; the call
+// must be finished, even when the OCI function fails. It returns
+// driver.ErrBadConn when c is closed.
+func (c *OCI8Conn) startCall(ctx context.Context) (*call, error) {
+	c.calls.Lock()
+	if c.closed {
+		c.calls.Unlock()
+		return nil, driver.ErrBadConn
+	}
+	if err := c.setCallTimeout(ctx); err != nil {
+		c.calls.Unlock()
+		return nil, err
+	}
+	c.callMu.Lock()
+	c.callState = callInFlight
+	c.callMu.Unlock()
+	cl := &call{c: c, ctx: ctx, deadline: c.callDeadline}
+	if ctx.Done() != nil {
+		cl.done = make(chan struct{})
+		cl.stopped = make(chan struct{})
+		go cl.watch()
+	}
+	return cl, nil
+}
+
+// watch breaks the call when ctx is done before it is finished. A deadline
+// which set the call timeout is left to OCI, which ends the call with
+// ORA-03156, for the caller to get a *TimeoutError.
+func (cl *call) watch() {
+	defer close(cl.stopped)
+	select {
+	case <-cl.ctx.Done():
+		if cl.deadline && cl.ctx.Err() == context.DeadlineExceeded {
+			return
+		}
+		cl.c.breakCall()
+	case <-cl.done:
+	}
+}
+
+// finish ends the call, which returned err. The connection is marked bad
+// when err tells the session is gone, see markBad. A broken call is followed
+// by OCIReset and returns the error of ctx. When OCIReset fails the
+// connection is marked bad too, for database/sql to discard it.
+func (cl *call) finish(err error) error {
+	c := cl.c
+	defer c.calls.Unlock()
+	err = c.markBad(err)
+	if cl.done != nil {
+		close(cl.done)
+		<-cl.stopped
+	}
+	c.callMu.Lock()
+	broken := c.callState == callBroken
+	c.callState = callIdle
+	c.callMu.Unlock()
+	if !broken {
+		return err
+	}
+	if rv := C.OCIReset(
+		c.svc,
+		(*C.OCIError)(c.err)); rv != C.OCI_SUCCESS {
+		c.bad = true
+	}
+	if err == nil {
+		// the call returned before the break
+		return nil
+	}
+	return cl.ctx.Err()
+}
+
+// breakCall sends OCIBreak when a call is in flight on c. The break has its
+// own error handle, as the one of c is in use by the call.
+func (c *OCI8Conn) breakCall() {
+	c.callMu.Lock()
+	defer c.callMu.Unlock()
+	if c.callState != callInFlight {
+		return
+	}
+	errh, err := newErrorHandle(c.env)
+	if err != nil {
+		return
+	}
+	defer C.OCIHandleFree(errh, C.OCI_HTYPE_ERROR)
+	if rv := C.OCIBreak(
+		c.svc,
+		(*C.OCIError)(errh)); rv == C.OCI_SUCCESS {
+		c.callState = callBroken
+	}
+}
@@ -0,0 +1,68 @@
+package oci8
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// CredentialProvider returns the username and password of a new connection.
+// It is called on every logon, so rotated secrets are picked up by new
+// connections. An empty username keeps the username of the DSN.
+type CredentialProvider func(ctx context.Context) (username, password string, err error)
+
+// PasswordChanger returns a new password for username when the logon fails
+// with ORA-28001 (the password has expired) or warns with ORA-28002 (the
+// password will expire soon), code being 28001 or 28002. The password is
+// changed on the logon, which fails when PasswordChanger does. An empty
+// newPassword leaves the password as it is.
+type PasswordChanger func(ctx context.Context, username, oldPassword string, code int) (newPassword string, err error)
+
+// PasswordFile returns a CredentialProvider reading the password from the
+// file path, without trailing newline.
+func PasswordFile(path string) CredentialProvider {
+	return func(ctx context.Context) (string, string, error) {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", "", err
+		}
+		return "", strings.TrimRight(string(b), "\r\n"), nil
+	}
+}
+
+// PasswordEnv returns a CredentialProvider reading the password from the
+// environment variable name.
+func PasswordEnv(name string) CredentialProvider {
+	return func(ctx context.Context) (string, string, error) {
+		password, ok := os.LookupEnv(name)
+		if !ok {
+			return "", "", fmt.Errorf("oci8: environment variable %s not set", name)
+		}
+		return "", password, nil
+	}
+}
+
+// credentials returns the username and password to log on with. Without
+// both, it fails unless external_auth is set, not to log on with external
+// credentials by mistake.
+func (dsn *DSN) credentials(ctx context.Context) (username, password string, err error) {
+	username, password = dsn.Username, dsn.Password
+	if dsn.Credentials != nil {
+		u, p, err := dsn.Credentials(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if u != "" {
+			username = u
+		}
+		password = p
+	}
+	if username == "" && password == "" && !dsn.external_auth {
+		return "", "", &DSNError{Param: "external_auth",
+			Reason: `no username nor password, use "/@connect" or external_auth=YES to log on with external credentials`}
+	}
+	return username, password, nil
+}
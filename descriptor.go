@@ -0,0 +1,329 @@
+package oci8
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Description is a connect descriptor:
+//
+//	(DESCRIPTION=
+//	  (ADDRESS_LIST=(LOAD_BALANCE=on)
+//	    (ADDRESS=(PROTOCOL=TCP)(HOST=node1)(PORT=1521))
+//	    (ADDRESS=(PROTOCOL=TCP)(HOST=node2)(PORT=1521)))
+//	  (CONNECT_DATA=(SERVICE_NAME=sales.example.com)))
+//
+// Build one as a literal and check it with Validate, or parse one with
+// ParseDescription. String returns the descriptor to connect with.
+type Description struct {
+	AddressLists []AddressList
+	ConnectData  ConnectData
+	LoadBalance  string // on or off, empty for the default off
+	Failover     string // on or off, empty for the default on
+	RetryCount   int
+	RetryDelay   int       // seconds
+	Options      []*NVPair // other parameters, like CONNECT_TIMEOUT
+}
+
+// AddressList is an ADDRESS_LIST. Addresses given directly in the
+// DESCRIPTION are parsed into an AddressList of their own.
+type AddressList struct {
+	Addresses   []NetAddress
+	LoadBalance string // on or off, empty for the default off
+	Failover    string // on or off, empty for the default on
+}
+
+// NetAddress is the ADDRESS of a listener.
+type NetAddress struct {
+	Protocol string // TCP or TCPS
+	Host     string
+	Port     int
+	Options  []*NVPair // other parameters, like HTTPS_PROXY
+}
+
+// ConnectData is the CONNECT_DATA of a connect descriptor.
+type ConnectData struct {
+	ServiceName  string
+	SID          string
+	InstanceName string
+	Server       string    // DEDICATED, SHARED or POOLED
+	Options      []*NVPair // other parameters, like FAILOVER_MODE
+}
+
+// descriptorOptions are the known parameters without a field of their own.
+var descriptorOptions = map[string]map[string]bool{
+	"DESCRIPTION": {
+		"CONNECT_TIMEOUT": true, "TRANSPORT_CONNECT_TIMEOUT": true, "EXPIRE_TIME": true,
+		"SOURCE_ROUTE": true, "ENABLE": true, "SDU": true, "SECURITY": true,
+		"TYPE_OF_SERVICE": true, "RECV_BUF_SIZE": true, "SEND_BUF_SIZE": true,
+	},
+	"ADDRESS": {
+		"HTTPS_PROXY": true, "HTTPS_PROXY_PORT": true, "KEY": true,
+		"RECV_BUF_SIZE": true, "SEND_BUF_SIZE": true,
+	},
+	"CONNECT_DATA": {
+		"FAILOVER_MODE": true, "GLOBAL_NAME": true, "HS": true, "RDB_DATABASE": true,
+		"TYPE_OF_SERVICE": true, "POOL_CONNECTION_CLASS": true, "POOL_PURITY": true,
+		"POOL_BOUNDARY": true, "COLOCATION_TAG": true,
+	},
+}
+
+// ParseDescription parses and validates the connect descriptor s.
+func ParseDescription(s string) (*Description, error) {
+	nv, err := ParseNVPair(s)
+	if err != nil {
+		return nil, err
+	}
+	return DescriptionFromNVPair(nv)
+}
+
+// DescriptionFromNVPair converts and validates the DESCRIPTION nv, as
+// returned by TNSNames.Lookup.
+func DescriptionFromNVPair(nv *NVPair) (*Description, error) {
+	if !strings.EqualFold(nv.Name, "DESCRIPTION") {
+		return nil, fmt.Errorf("oci8: expected DESCRIPTION but %s", nv.Name)
+	}
+	d := &Description{}
+	var direct []NetAddress
+	for _, c := range nv.Children {
+		var err error
+		switch name := strings.ToUpper(c.Name); name {
+		case "ADDRESS":
+			var addr NetAddress
+			if addr, err = netAddressFromNVPair(c); err == nil {
+				direct = append(direct, addr)
+			}
+		case "ADDRESS_LIST":
+			var l AddressList
+			if l, err = addressListFromNVPair(c); err == nil {
+				d.AddressLists = append(d.AddressLists, l)
+			}
+		case "CONNECT_DATA":
+			d.ConnectData, err = connectDataFromNVPair(c)
+		case "LOAD_BALANCE":
+			d.LoadBalance, err = nvValue(c)
+		case "FAILOVER":
+			d.Failover, err = nvValue(c)
+		case "RETRY_COUNT":
+			d.RetryCount, err = nvInt(c)
+		case "RETRY_DELAY":
+			d.RetryDelay, err = nvInt(c)
+		default:
+			if !descriptorOptions["DESCRIPTION"][name] {
+				return nil, unknownKeyError("DESCRIPTION", c.Name)
+			}
+			d.Options = append(d.Options, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(direct) > 0 {
+		d.AddressLists = append([]AddressList{{Addresses: direct}}, d.AddressLists...)
+	}
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func addressListFromNVPair(nv *NVPair) (l AddressList, err error) {
+	for _, c := range nv.Children {
+		switch strings.ToUpper(c.Name) {
+		case "ADDRESS":
+			var addr NetAddress
+			if addr, err = netAddressFromNVPair(c); err == nil {
+				l.Addresses = append(l.Addresses, addr)
+			}
+		case "LOAD_BALANCE":
+			l.LoadBalance, err = nvValue(c)
+		case "FAILOVER":
+			l.Failover, err = nvValue(c)
+		default:
+			return l, unknownKeyError("ADDRESS_LIST", c.Name)
+		}
+		if err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+func netAddressFromNVPair(nv *NVPair) (a NetAddress, err error) {
+	for _, c := range nv.Children {
+		switch name := strings.ToUpper(c.Name); name {
+		case "PROTOCOL":
+			a.Protocol, err = nvValue(c)
+		case "HOST":
+			a.Host, err = nvValue(c)
+		case "PORT":
+			a.Port, err = nvInt(c)
+		default:
+			if !descriptorOptions["ADDRESS"][name] {
+				return a, unknownKeyError("ADDRESS", c.Name)
+			}
+			a.Options = append(a.Options, c)
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+func connectDataFromNVPair(nv *NVPair) (cd ConnectData, err error) {
+	for _, c := range nv.Children {
+		switch name := strings.ToUpper(c.Name); name {
+		case "SERVICE_NAME":
+			cd.ServiceName, err = nvValue(c)
+		case "SID":
+			cd.SID, err = nvValue(c)
+		case "INSTANCE_NAME":
+			cd.InstanceName, err = nvValue(c)
+		case "SERVER":
+			cd.Server, err = nvValue(c)
+		default:
+			if !descriptorOptions["CONNECT_DATA"][name] {
+				return cd, unknownKeyError("CONNECT_DATA", c.Name)
+			}
+			cd.Options = append(cd.Options, c)
+		}
+		if err != nil {
+			return cd, err
+		}
+	}
+	return cd, nil
+}
+
+func unknownKeyError(parent, name string) error {
+	return fmt.Errorf("oci8: unknown parameter %s in %s", name, parent)
+}
+
+func nvValue(nv *NVPair) (string, error) {
+	if len(nv.Children) > 0 {
+		return "", fmt.Errorf("oci8: %s needs a value", nv.Name)
+	}
+	return nv.Value, nil
+}
+
+func nvInt(nv *NVPair) (int, error) {
+	v, err := nvValue(nv)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("oci8: invalid %s: %s", nv.Name, v)
+	}
+	return n, nil
+}
+
+func validSwitch(name, v string) error {
+	switch strings.ToLower(v) {
+	case "", "on", "off", "yes", "no", "true", "false":
+		return nil
+	}
+	return fmt.Errorf("oci8: invalid %s: %s", name, v)
+}
+
+// Validate checks that d has an address, either a service name or a SID,
+// and valid parameters.
+func (d *Description) Validate() error {
+	if err := validSwitch("LOAD_BALANCE", d.LoadBalance); err != nil {
+		return err
+	}
+	if err := validSwitch("FAILOVER", d.Failover); err != nil {
+		return err
+	}
+	if d.RetryCount < 0 || d.RetryDelay < 0 {
+		return errors.New("oci8: RETRY_COUNT and RETRY_DELAY can't be negative")
+	}
+	n := 0
+	for _, l := range d.AddressLists {
+		if err := validSwitch("LOAD_BALANCE", l.LoadBalance); err != nil {
+			return err
+		}
+		if err := validSwitch("FAILOVER", l.Failover); err != nil {
+			return err
+		}
+		for _, a := range l.Addresses {
+			switch strings.ToUpper(a.Protocol) {
+			case "", "TCP", "TCPS":
+				if a.Host == "" {
+					return errors.New("oci8: ADDRESS without HOST")
+				}
+				if a.Port <= 0 || a.Port > 65535 {
+					return fmt.Errorf("oci8: invalid PORT %d of %s", a.Port, a.Host)
+				}
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		return errors.New("oci8: DESCRIPTION without ADDRESS")
+	}
+	cd := d.ConnectData
+	if cd.ServiceName == "" && cd.SID == "" {
+		return errors.New("oci8: CONNECT_DATA needs SERVICE_NAME or SID")
+	}
+	if cd.ServiceName != "" && cd.SID != "" {
+		return errors.New("oci8: CONNECT_DATA can't have both SERVICE_NAME and SID")
+	}
+	return nil
+}
+
+// NVPair returns d as a name-value pair.
+func (d *Description) NVPair() *NVPair {
+	desc := &NVPair{Name: "DESCRIPTION"}
+	add := func(nv *NVPair, name, value string) {
+		if value != "" {
+			nv.Children = append(nv.Children, &NVPair{Name: name, Value: value})
+		}
+	}
+	add(desc, "LOAD_BALANCE", d.LoadBalance)
+	add(desc, "FAILOVER", d.Failover)
+	if d.RetryCount > 0 {
+		add(desc, "RETRY_COUNT", strconv.Itoa(d.RetryCount))
+	}
+	if d.RetryDelay > 0 {
+		add(desc, "RETRY_DELAY", strconv.Itoa(d.RetryDelay))
+	}
+	desc.Children = append(desc.Children, d.Options...)
+
+	for _, l := range d.AddressLists {
+		list := &NVPair{Name: "ADDRESS_LIST"}
+		add(list, "LOAD_BALANCE", l.LoadBalance)
+		add(list, "FAILOVER", l.Failover)
+		for _, a := range l.Addresses {
+			addr := &NVPair{Name: "ADDRESS"}
+			protocol := a.Protocol
+			if protocol == "" {
+				protocol = "TCP"
+			}
+			add(addr, "PROTOCOL", protocol)
+			add(addr, "HOST", a.Host)
+			if a.Port != 0 {
+				add(addr, "PORT", strconv.Itoa(a.Port))
+			}
+			addr.Children = append(addr.Children, a.Options...)
+			list.Children = append(list.Children, addr)
+		}
+		desc.Children = append(desc.Children, list)
+	}
+
+	cd := &NVPair{Name: "CONNECT_DATA"}
+	add(cd, "SERVICE_NAME", d.ConnectData.ServiceName)
+	add(cd, "SID", d.ConnectData.SID)
+	add(cd, "INSTANCE_NAME", d.ConnectData.InstanceName)
+	add(cd, "SERVER", d.ConnectData.Server)
+	cd.Children = append(cd.Children, d.ConnectData.Options...)
+	desc.Children = append(desc.Children, cd)
+	return desc
+}
+
+// String returns the connect descriptor of d.
+func (d *Description) String() string {
+	return d.NVPair().String()
+}
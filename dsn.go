@@ -355,3 +355,98 @@ func (v Values) Encode() string {
 	}
 	return buf.String()
 }
+
+// FormatDSN returns the DSN string of dsn, which ParseDSN parses back to an
+// equivalent DSN. Parameters at their default are left out.
+func FormatDSN(dsn *DSN) string {
+	return dsn.format(dsn.Password)
+}
+
+// String implement fmt.Stringer, see FormatDSN.
+func (dsn *DSN) String() string {
+	return FormatDSN(dsn)
+}
+
+// Redacted is like String but with the password replaced by "xxxxx", for
+// logging.
+func (dsn *DSN) Redacted() string {
+	if dsn.Password == "" {
+		return dsn.format("")
+	}
+	return dsn.format("xxxxx")
+}
+
+func (dsn *DSN) format(password string) string {
+	var buf bytes.Buffer
+	buf.WriteString(escape(dsn.Username, encodeUserPassword))
+	if dsn.EndUser != "" {
+		buf.WriteByte('[')
+		buf.WriteString(escape(dsn.EndUser, encodeUserPassword))
+		buf.WriteByte(']')
+	}
+	params := dsn.params()
+	if password != "" {
+		buf.WriteByte('/')
+		buf.WriteString(escape(password, encodeUserPassword))
+	} else if dsn.external_auth && dsn.Username == "" && dsn.EndUser == "" {
+		buf.WriteByte('/')
+		params.Del("external_auth")
+	}
+	buf.WriteByte('@')
+
+	connect := dsn.Connect
+	var options Values
+	if dsn.EZConnect != nil {
+		ez := *dsn.EZConnect
+		options, ez.Options = ez.Options, nil
+		connect = ez.String()
+	}
+	buf.WriteString(escapeConnect(connect))
+
+	for k, v := range options {
+		params[k] = v
+	}
+	if len(params) > 0 {
+		buf.WriteByte('?')
+		buf.WriteString(encodeSorted(params))
+	}
+	return buf.String()
+}
+
+// escapeConnect escapes the characters of a connect string which ParseDSN
+// would take for delimiters.
+func escapeConnect(s string) string {
+	r := strings.NewReplacer("%", "%25", "@", "%40", "?", "%3F")
+	return r.Replace(s)
+}
+
+// parseParams parses the query string of a DSN into key-value pairs, in
+// order. Unlike ParseQuery, it fails on the first malformed escape.
+func parseParams(query string) ([][2]string, error) {
+	var params [][2]string
+	for query != "" {
+		key := query
+		if i := strings.IndexAny(key, "&;"); i >= 0 {
+			key, query = key[:i], key[i+1:]
+		} else {
+			query = ""
+		}
+		if key == "" {
+			continue
+		}
+		value := ""
+		if i := strings.Index(key, "="); i >= 0 {
+			key, value = key[:i], key[i+1:]
+		}
+		k, err := QueryUnescape(key)
+		if err != nil {
+			return nil, &DSNError{Param: key, Value: value, Reason: err.Error()}
+		}
+		v, err := QueryUnescape(value)
+		if err != nil {
+			return nil, &DSNError{Param: k, Value: value, Reason: err.Error()}
+		}
+		params = append(params, [2]string{k, v})
+	}
+	return params, nil
+}
@@ -0,0 +1,106 @@
+package oci8
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// OCI8Error is the error returned for failed OCI calls. Use errors.As to get
+// at the ORA code, e.g. to detect unique constraint violations:
+//
+//	var oe *oci8.OCI8Error
+//	if errors.As(err, &oe) && oe.Code == 1 {
+//
+// or errors.Is with a template carrying only the code:
+//
+//	if errors.Is(err, &oci8.OCI8Error{Code: 1}) {
+type OCI8Error struct {
+	Code    int    // ORA code of the first error record
+	Message string // message of the first error record
+	Records []OCI8ErrorRecord
+	SQL     string // statement being executed, if any
+	Offset  int    // parse error offset into SQL
+}
+
+// OCI8ErrorRecord is one of the error records of an OCI error handle.
+type OCI8ErrorRecord struct {
+	Code    int
+	Message string
+}
+
+func (e *OCI8Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Code == 0 {
+		// OCIErrorGet gave no record
+		return "oci8: OCI call failed without an error record"
+	}
+	return fmt.Sprintf("ORA-%05d", e.Code)
+}
+
+// Is reports whether target is an *OCI8Error with the same code as e or any
+// of its records.
+func (e *OCI8Error) Is(target error) bool {
+	t, ok := target.(*OCI8Error)
+	if !ok || t.Code == 0 {
+		return false
+	}
+	if t.Code == e.Code {
+		return true
+	}
+	for _, r := range e.Records {
+		if t.Code == r.Code {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeoutError is the error of a round trip that ran out of time, by the
+// deadline of its context or the DSN parameter call_timeout. It is
+// ORA-03156, see Err. When the deadline ran out,
+// errors.Is(err, context.DeadlineExceeded) holds.
+type TimeoutError struct {
+	Limit    time.Duration // time limit of the call
+	Err      *OCI8Error
+	deadline bool
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("oci8: call timed out after %v: %v", e.Limit, e.Err)
+}
+
+// Timeout reports true, like net.Error.
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Unwrap returns Err.
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is context.DeadlineExceeded and the deadline of
+// the context limited the call.
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded && e.deadline
+}
+
+// DSNError is the error of ParseDSN for an invalid parameter.
+type DSNError struct {
+	Param   string // parameter as given in the DSN
+	Value   string
+	Reason  string // e.g. "unknown parameter"
+	Closest string // known parameter closest to an unknown Param, if any
+}
+
+func (e *DSNError) Error() string {
+	msg := fmt.Sprintf("oci8: DSN parameter %q: %s", e.Param, e.Reason)
+	if e.Closest != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Closest)
+	}
+	return msg
+}
@@ -0,0 +1,241 @@
+package oci8
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EZConnect is the parsed form of an EZConnect Plus connect string:
+//
+//	[[protocol:]//]host1[,host2][:port][/[service_name][:server][/instance_name]][?option=value]
+type EZConnect struct {
+	Protocol     string    // tcp or tcps, empty for the default
+	Addresses    []Address // at least one
+	ServiceName  string
+	Server       string // dedicated, shared or pooled
+	InstanceName string
+	Options      Values // EZConnect Plus options, passed to oracle as they are
+}
+
+// Address is the host and port of a listener. Port 0 means the default
+// port 1521.
+type Address struct {
+	Host string
+	Port int
+}
+
+// ezConnectOptions are the EZConnect Plus options. They are given in the
+// query string of a DSN together with the parameters of the driver.
+var ezConnectOptions = map[string]bool{
+	"connect_timeout":           true,
+	"transport_connect_timeout": true,
+	"retry_count":               true,
+	"retry_delay":               true,
+	"expire_time":               true,
+	"failover":                  true,
+	"load_balance":              true,
+	"source_route":              true,
+	"sdu":                       true,
+	"https_proxy":               true,
+	"https_proxy_port":          true,
+	"ssl_server_dn_match":       true,
+	"ssl_server_cert_dn":        true,
+	"pool_boundary":             true,
+}
+
+// isEZConnect reports whether the connect string s is in EZConnect form,
+// not a connect descriptor nor a tnsnames.ora alias.
+func isEZConnect(s string) bool {
+	return !strings.Contains(s, "(") && strings.ContainsAny(s, "/:,")
+}
+
+// ParseEZConnect parses the EZConnect Plus connect string s.
+func ParseEZConnect(s string) (*EZConnect, error) {
+	ez := &EZConnect{}
+	s, params := splitRight(s, "?")
+	if params != "" {
+		var err error
+		if ez.Options, err = parseEZOptions(params); err != nil {
+			return nil, err
+		}
+	}
+
+	if i := strings.Index(s, "//"); i >= 0 && !strings.Contains(s[:i], "/") {
+		ez.Protocol = strings.TrimSuffix(s[:i], ":")
+		s = s[i+2:]
+	}
+
+	hosts, path := split(s, "/")
+	if hosts == "" {
+		return nil, fmt.Errorf("oci8: missing host in connect string %q", s)
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		addr, err := parseAddress(h)
+		if err != nil {
+			return nil, err
+		}
+		ez.Addresses = append(ez.Addresses, addr)
+	}
+	// host1,host2:port means both hosts listen on port
+	port := 0
+	for i := len(ez.Addresses) - 1; i >= 0; i-- {
+		if ez.Addresses[i].Port == 0 {
+			ez.Addresses[i].Port = port
+		} else {
+			port = ez.Addresses[i].Port
+		}
+	}
+
+	service, instance := split(path, "/")
+	ez.ServiceName, ez.Server = split(service, ":")
+	ez.InstanceName = instance
+	return ez, nil
+}
+
+func parseAddress(s string) (Address, error) {
+	host, port := s, ""
+	if strings.HasPrefix(s, "[") {
+		// [ipv6]:port
+		i := strings.Index(s, "]")
+		if i < 0 {
+			return Address{}, fmt.Errorf("oci8: invalid host %q", s)
+		}
+		host, port = s[:i+1], strings.TrimPrefix(s[i+1:], ":")
+	} else if i := strings.Index(s, ":"); i >= 0 {
+		host, port = s[:i], s[i+1:]
+	}
+	if host == "" {
+		return Address{}, fmt.Errorf("oci8: missing host in %q", s)
+	}
+	addr := Address{Host: host}
+	if port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return Address{}, fmt.Errorf("oci8: invalid port in %q", s)
+		}
+		addr.Port = int(p)
+	}
+	return addr, nil
+}
+
+// String returns the connect string of ez.
+func (ez *EZConnect) String() string {
+	var b bytes.Buffer
+	if ez.Protocol != "" {
+		b.WriteString(ez.Protocol)
+		b.WriteString("://")
+	}
+	for i, addr := range ez.Addresses {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(addr.Host)
+		if addr.Port != 0 {
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(addr.Port))
+		}
+	}
+	if ez.ServiceName != "" || ez.Server != "" || ez.InstanceName != "" {
+		b.WriteByte('/')
+		b.WriteString(ez.ServiceName)
+	}
+	if ez.Server != "" {
+		b.WriteByte(':')
+		b.WriteString(ez.Server)
+	}
+	if ez.InstanceName != "" {
+		b.WriteByte('/')
+		b.WriteString(ez.InstanceName)
+	}
+	if len(ez.Options) > 0 {
+		b.WriteByte('?')
+		b.WriteString(encodeEZOptions(ez.Options))
+	}
+	return b.String()
+}
+
+// ezReserved are the characters of an option value which need double
+// quotes. Oracle reads the values as they are, without URL decoding.
+const ezReserved = "&=?\"(), \t"
+
+// encodeEZOptions writes the options v, sorted by key, as EZConnect Plus
+// does: raw values, double quoted when they contain reserved characters.
+func encodeEZOptions(v Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		for _, vv := range v[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(k)
+			b.WriteByte('=')
+			if strings.ContainsAny(vv, ezReserved) {
+				b.WriteByte('"')
+				b.WriteString(vv)
+				b.WriteByte('"')
+			} else {
+				b.WriteString(vv)
+			}
+		}
+	}
+	return b.String()
+}
+
+// parseEZOptions parses the options of an EZConnect Plus connect string,
+// see encodeEZOptions.
+func parseEZOptions(s string) (Values, error) {
+	v := Values{}
+	for s != "" {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("oci8: invalid option in %q", s)
+		}
+		k := s[:i]
+		s = s[i+1:]
+		var value string
+		if strings.HasPrefix(s, "\"") {
+			j := strings.IndexByte(s[1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("oci8: unterminated quote in option %s", k)
+			}
+			value, s = s[1:j+1], s[j+2:]
+			if s != "" && s[0] != '&' {
+				return nil, fmt.Errorf("oci8: invalid option %s", k)
+			}
+			s = strings.TrimPrefix(s, "&")
+		} else {
+			value, s = split(s, "&")
+		}
+		v.Add(k, value)
+	}
+	return v, nil
+}
+
+// encodeSorted is Values.Encode with keys sorted, for stable output.
+func encodeSorted(v Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		for _, vv := range v[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(QueryEscape(k))
+			b.WriteByte('=')
+			b.WriteString(QueryEscape(vv))
+		}
+	}
+	return b.String()
+}
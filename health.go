@@ -0,0 +1,122 @@
+package oci8
+
+/*
+#include <oci.h>
+
+// WrapOCIServerStatus returns the OCI_ATTR_SERVER_STATUS of the server of
+// svc, which OCI keeps without a round trip.
+static ub4
+WrapOCIServerStatus(OCISvcCtx *svc, OCIError *err) {
+  OCIServer *srv = NULL;
+  ub4 status = OCI_SERVER_NOT_CONNECTED;
+  if (OCIAttrGet(svc, OCI_HTYPE_SVCCTX, &srv, NULL, OCI_ATTR_SERVER, err) != OCI_SUCCESS || srv == NULL ||
+      OCIAttrGet(srv, OCI_HTYPE_SERVER, &status, NULL, OCI_ATTR_SERVER_STATUS, err) != OCI_SUCCESS) {
+    return OCI_SERVER_NOT_CONNECTED;
+  }
+  return status;
+}
+
+// WrapOCITransactionInProgress reports whether the session of svc has a
+// transaction open, without a round trip. Clients before release 12.1 can't
+// tell, a transaction is assumed to be open.
+static boolean
+WrapOCITransactionInProgress(OCISvcCtx *svc, OCIError *err) {
+#if OCI_MAJOR_VERSION >= 12
+  OCISession *usr = NULL;
+  boolean inprogress = 0;
+  if (OCIAttrGet(svc, OCI_HTYPE_SVCCTX, &usr, NULL, OCI_ATTR_SESSION, err) != OCI_SUCCESS || usr == NULL ||
+      OCIAttrGet(usr, OCI_HTYPE_SESSION, &inprogress, NULL, OCI_ATTR_TRANSACTION_IN_PROGRESS, err) != OCI_SUCCESS) {
+    return 0;
+  }
+  return inprogress;
+#else
+  return 1;
+#endif
+}
+
+// WrapOCIClearAppInfo clears the module, action and client info of the
+// session of svc. They are sent with the next round trip.
+static sword
+WrapOCIClearAppInfo(OCISvcCtx *svc, OCIError *err) {
+  OCISession *usr = NULL;
+  sword rv;
+  if ((rv = OCIAttrGet(svc, OCI_HTYPE_SVCCTX, &usr, NULL, OCI_ATTR_SESSION, err)) != OCI_SUCCESS) {
+    return rv;
+  }
+  if ((rv = OCIAttrSet(usr, OCI_HTYPE_SESSION, (OraText*)"", 0, OCI_ATTR_MODULE, err)) != OCI_SUCCESS ||
+      (rv = OCIAttrSet(usr, OCI_HTYPE_SESSION, (OraText*)"", 0, OCI_ATTR_ACTION, err)) != OCI_SUCCESS) {
+    return rv;
+  }
+  return OCIAttrSet(usr, OCI_HTYPE_SESSION, (OraText*)"", 0, OCI_ATTR_CLIENT_INFO, err);
+}
+*/
+import "C"
+
+import (
+	"database/sql/driver"
+
+	"golang.org/x/net/context"
+)
+
+// resetPackagesSQL discards the state of PL/SQL packages in the session.
+const resetPackagesSQL = "begin dbms_session.modify_package_state(dbms_session.reinitialize); end;"
+
+// markBad marks c bad when err tells the session is gone, and returns err.
+func (c *OCI8Conn) markBad(err error) error {
+	if err == driver.ErrBadConn {
+		c.bad = true
+	}
+	return err
+}
+
+// isValid reports whether c can be used, by what is known of it without a
+// round trip.
+func (c *OCI8Conn) isValid() bool {
+	c.calls.Lock()
+	defer c.calls.Unlock()
+	if c.closed || c.bad {
+		return false
+	}
+	if C.WrapOCIServerStatus((*C.OCISvcCtx)(c.svc), (*C.OCIError)(c.err)) != C.OCI_SERVER_NORMAL {
+		c.bad = true
+		return false
+	}
+	return true
+}
+
+// setBad marks c bad, for database/sql to discard it, and returns
+// driver.ErrBadConn.
+func (c *OCI8Conn) setBad() error {
+	c.calls.Lock()
+	c.bad = true
+	c.calls.Unlock()
+	return driver.ErrBadConn
+}
+
+// resetSession prepares c to be used again: it rolls back a transaction left
+// open, clears the module, action and client info and, with the DSN
+// parameter reset_packages, resets the state of PL/SQL packages.
+func (c *OCI8Conn) resetSession(ctx context.Context) error {
+	if !c.isValid() {
+		return driver.ErrBadConn
+	}
+	// the app info is cleared with the next round trip
+	c.calls.Lock()
+	inTransaction := c.inTransaction || C.WrapOCITransactionInProgress((*C.OCISvcCtx)(c.svc), (*C.OCIError)(c.err)) != 0
+	rv := C.WrapOCIClearAppInfo((*C.OCISvcCtx)(c.svc), (*C.OCIError)(c.err))
+	c.calls.Unlock()
+	if rv != C.OCI_SUCCESS {
+		return c.setBad()
+	}
+	if inTransaction {
+		if err := (&OCI8Tx{c}).Rollback(); err != nil {
+			return c.setBad()
+		}
+	}
+	if c.reset_packages {
+		if _, err := c.exec(ctx, resetPackagesSQL, nil); err != nil {
+			return c.setBad()
+		}
+	}
+	return nil
+}
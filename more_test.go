@@ -5,6 +5,7 @@ package oci8
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"math/rand"
 	"os"
@@ -12,6 +13,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
 type dbc interface {
@@ -58,6 +61,26 @@ func DB() *sql.DB {
 	return db
 }
 
+// testDSN returns the DSN of the tests with the parameters params, given as
+// name, value pairs.
+func testDSN(t *testing.T, params ...string) *DSN {
+	DB()
+	dsn := os.Getenv("DSN")
+	if dsn == "" {
+		dsn = "scott/tiger@XE"
+	}
+	d, err := ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(params); i += 2 {
+		if err = d.SetParam(params[i], params[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return d
+}
+
 func TestTruncate(t *testing.T) {
 	_, err := DB().Exec("truncate table foo")
 	if err != nil {
@@ -931,3 +954,182 @@ func zzTestMem(t *testing.T) {
 		TestTimestampLtz(t)
 	}
 }
+
+func TestOCI8Error(t *testing.T) {
+	const query = "select c1, from foo"
+	_, err := DB().Query(query)
+	oe, ok := err.(*OCI8Error)
+	if !ok {
+		t.Fatalf("want *OCI8Error but %T: %v", err, err)
+	}
+	if oe.Code != 936 {
+		t.Errorf("want code %d but %d", 936, oe.Code)
+	}
+	if oe.SQL != query {
+		t.Errorf("want SQL %q but %q", query, oe.SQL)
+	}
+	if oe.Offset != strings.Index(query, "from") {
+		t.Errorf("want offset %d but %d", strings.Index(query, "from"), oe.Offset)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	dc, err := testDSN(t).connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	c := dc.(*OCI8Conn)
+
+	if err = c.Savepoint("a"); err != errNoTransaction {
+		t.Fatalf("want %v but %v", errNoTransaction, err)
+	}
+
+	dtx, err := c.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := dtx.(*OCI8Tx)
+	defer tx.Rollback()
+
+	count := func() (n int64) {
+		stmt, err := c.Prepare("select count(*) from foo where c1 = 'savepoint'")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stmt.Close()
+		rows, err := stmt.Query(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		dest := make([]driver.Value, 1)
+		if err = rows.Next(dest); err != nil {
+			t.Fatal(err)
+		}
+		return dest[0].(int64)
+	}
+	insert := func() error {
+		_, err := c.Exec("insert into foo(c1) values('savepoint')", nil)
+		return err
+	}
+
+	if err = insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Savepoint("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = insert(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.RollbackTo("a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("want %v rows but %v", 1, n)
+	}
+
+	failed := fmt.Errorf("failed")
+	err = tx.InSavepoint("b", func() error {
+		if err := insert(); err != nil {
+			t.Fatal(err)
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("want %v but %v", failed, err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("want %v rows but %v", 1, n)
+	}
+
+	if err = tx.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.RollbackTo("a"); err == nil {
+		t.Fatal("expected an error rolling back to a released savepoint")
+	}
+	if err = tx.Savepoint("x; drop table foo"); err == nil {
+		t.Fatal("expected an error for invalid savepoint name")
+	}
+}
+
+func TestXA(t *testing.T) {
+	d := testDSN(t)
+	var conns [2]*OCI8Conn
+	for i := range conns {
+		dc, err := d.connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dc.Close()
+		conns[i] = dc.(*OCI8Conn)
+	}
+
+	xid := XID{
+		FormatID:            0x1234,
+		GlobalTransactionID: []byte(fmt.Sprintf("gtrid-%d", time.Now().UnixNano())),
+		BranchQualifier:     []byte("bqual"),
+	}
+	if err := conns[0].XAStart(context.Background(), xid, 60*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conns[0].Exec("insert into foo(c1) values('xa')", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := conns[0].XAEnd(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, err := conns[1].XAPrepare(context.Background(), xid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readOnly {
+		t.Fatal("branch with an insert should not be read-only")
+	}
+	if err = conns[1].XACommit(context.Background(), xid, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err = DB().QueryRow("select count(*) from foo where c1 = 'xa'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want %v rows but %v", 1, n)
+	}
+
+	// the ended branch is off the connection, local transactions work
+	if conns[0].xa != nil || conns[1].xa != nil {
+		t.Fatal("want the XA transaction handles released")
+	}
+	tx, err := conns[1].Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conns[1].Exec("insert into foo(c1) values('local')", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = conns[0].XAStart(context.Background(), XID{}, 0); err == nil {
+		t.Fatal("expected an error for empty XID")
+	}
+	if err = conns[0].XAStart(context.Background(), xid, -time.Second); err == nil {
+		t.Fatal("expected an error for negative timeout")
+	}
+	if err = conns[0].XAEnd(context.Background()); err == nil {
+		t.Fatal("expected an error ending without a branch")
+	}
+
+	// XA calls are limited by the deadline of their context
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err = conns[0].XAStart(ctx, xid, 60*time.Second); err != context.DeadlineExceeded {
+		t.Fatalf("want %v but %v", context.DeadlineExceeded, err)
+	}
+}
@@ -8,16 +8,54 @@ package oci8
 
 #cgo pkg-config: oci8
 
+// attributes of later clients, which are not used with older ones, see
+// ociMajorVersion
+#if OCI_MAJOR_VERSION < 12
+#define OCI_RETURN_ROW_COUNT_ARRAY 0
+#define OCI_ATTR_DML_ROW_COUNT_ARRAY 0
+#endif
+#if OCI_MAJOR_VERSION < 18
+#define OCI_ATTR_CALL_TIMEOUT 0
+#endif
+
 typedef struct {
   char err[1024];
+  sb4 code;
   sword rv;
 } retErr;
 
 static retErr
-WrapOCIErrorGet(OCIError *err) {
+WrapOCIErrorGet(OCIError *err, ub4 recordno) {
   retErr vvv;
-  sb4 errcode;
-  OCIErrorGet(err, 1, NULL, &errcode, (OraText*) vvv.err, sizeof(vvv.err), OCI_HTYPE_ERROR);
+  vvv.err[0] = 0;
+  vvv.code = 0;
+  vvv.rv = OCIErrorGet(err, recordno, NULL, &vvv.code, (OraText*) vvv.err, sizeof(vvv.err), OCI_HTYPE_ERROR);
+  return vvv;
+}
+
+typedef struct {
+  ub4 offset;
+  sb4 code;
+  char err[1024];
+  sword rv;
+} retBatchErr;
+
+static retBatchErr
+WrapOCIBatchErrorGet(OCIEnv *env, OCIError *err, ub4 i) {
+  retBatchErr vvv = {0, 0, {0}, 0};
+  OCIError *eh = NULL;
+  vvv.rv = OCIHandleAlloc(env, (dvoid**)&eh, OCI_HTYPE_ERROR, 0, NULL);
+  if (vvv.rv != OCI_SUCCESS) {
+    return vvv;
+  }
+  vvv.rv = OCIParamGet(err, OCI_HTYPE_ERROR, err, (dvoid**)&eh, i);
+  if (vvv.rv == OCI_SUCCESS) {
+    vvv.rv = OCIAttrGet(eh, OCI_HTYPE_ERROR, &vvv.offset, NULL, OCI_ATTR_DML_ROW_OFFSET, err);
+  }
+  if (vvv.rv == OCI_SUCCESS) {
+    OCIErrorGet(eh, 1, NULL, &vvv.code, (OraText*) vvv.err, sizeof(vvv.err), OCI_HTYPE_ERROR);
+  }
+  OCIHandleFree(eh, OCI_HTYPE_ERROR);
   return vvv;
 }
 
@@ -216,22 +254,6 @@ WrapOCIEnvCreate(ub4 mode, size_t extra) {
   return vvv;
 }
 
-static ret1ptr
-WrapOCILogon(OCIEnv *env, OCIError *err, OraText *u, ub4 ulen, OraText *p, ub4 plen, OraText *h, ub4 hlen) {
-  ret1ptr vvv = {NULL, 0};
-  vvv.rv = OCILogon(
-    env,
-    err,
-    (OCISvcCtx**)(&vvv.ptr),
-    u,
-    ulen,
-    p,
-    plen,
-    h,
-    hlen);
-  return vvv;
-}
-
 typedef struct {
   ub4 ff;
   sb2 y;
@@ -355,6 +377,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -363,6 +386,16 @@ import (
 
 const blobBufSize = 4000
 
+// ociMajorVersion is the release of the OCI headers the package is built
+// with. Features of later releases fail with clientVersionError.
+const ociMajorVersion = C.OCI_MAJOR_VERSION
+
+// clientVersionError is the error of feature, which needs an Oracle client
+// of release version or later.
+func clientVersionError(feature string, version string) error {
+	return fmt.Errorf("oci8: %s needs an Oracle client of release %s or later", feature, version)
+}
+
 /**
 ORA-03114: Not Connected to Oracle
 ORA-01012: Not logged on
@@ -371,18 +404,42 @@ ORA-12528: TNS:listener: all appropriate instances are blocking new connections
 ORA-12537: TNS:connection closed
 ORA-01033: ORACLE initialization or shutdown in progress
 ORA-01034: ORACLE not available
+ORA-03135: connection lost contact
 */
-var badConnCodes = []string{"ORA-03114", "ORA-01012", "ORA-03113", "ORA-12528", "ORA-12537", "ORA-01033", "ORA-01034"}
+var badConnCodes = []int{3114, 1012, 3113, 12528, 12537, 1033, 1034, 3135}
 
 type DSN struct {
-	Connect              string
-	Username             string
-	Password             string
-	prefetch_rows        uint32
-	prefetch_memory      uint32
-	Location             *time.Location
-	transactionMode      C.ub4
-	enableQMPlaceholders bool
+	Connect               string     // connect string as given
+	EZConnect             *EZConnect // parsed Connect in EZConnect form, used instead of Connect when set
+	Descriptor            *NVPair    // parsed Connect in descriptor form, or connect descriptor of the tnsnames.ora alias in Connect
+	Username              string
+	Password              string
+	EndUser               string // user connected through the proxy user Username
+	prefetch_rows         uint32
+	prefetch_memory       uint32
+	fetch_array_size      uint32
+	Location              *time.Location
+	transactionMode       C.ub4
+	enableQMPlaceholders  bool
+	tns_admin             string
+	strict                bool
+	external_auth         bool
+	wallet_location       string
+	privilege             C.ub4 // mode of OCISessionBegin
+	proxy_roles           string
+	pool_min              uint32
+	pool_max              uint32 // no session pool when 0
+	pool_increment        uint32
+	pool_timeout          uint32 // seconds
+	pool_getmode          C.ub4
+	pool_stmt_cache_size  uint32
+	pool_connection_class string
+	pool_purity           C.ub4 // OCI_SESSGET_PURITY_NEW or OCI_SESSGET_PURITY_SELF
+	stmt_cache_size       uint32
+	reset_packages        bool
+	call_timeout          time.Duration
+	Credentials           CredentialProvider // overrides Username and Password when set
+	ChangePassword        PasswordChanger    // called on ORA-28001 and ORA-28002
 }
 
 func init() {
@@ -394,15 +451,36 @@ type OCI8Driver struct {
 
 type OCI8Conn struct {
 	svc                  unsafe.Pointer
+	srv                  unsafe.Pointer
+	usr                  unsafe.Pointer
+	proxy                unsafe.Pointer // session of the proxy user, by proxyLogon
+	auth                 unsafe.Pointer // auth info of OCISessionGet
 	env                  unsafe.Pointer
 	err                  unsafe.Pointer
 	prefetch_rows        uint32
 	prefetch_memory      uint32
+	fetch_array_size     uint32
 	location             *time.Location
 	transactionMode      C.ub4
 	inTransaction        bool
+	savepoints           []string       // savepoints of the open transaction
+	xa                   *C.OCITrans    // transaction handle of the last XA call
+	trans                unsafe.Pointer // transaction handle of begin, freed on Close
 	enableQMPlaceholders bool
+	stmt_cache_size      uint32
+	reset_packages       bool
+	call_timeout         time.Duration
+	bad                  bool // the session is gone, see markBad
+	stmtCacheHits        uint64
+	stmtCacheMisses      uint64
+	cursors              map[*OCI8Rows]struct{} // REF CURSOR rows not closed yet
 	closed               bool
+	callTimeout          C.ub4      // OCI_ATTR_CALL_TIMEOUT in ms, as set
+	callDeadline         bool       // callTimeout is from the deadline of a context
+	calls                sync.Mutex // held by the call in flight, see startCall
+	callMu               sync.Mutex // guards callState
+	callState            callState
+	pool                 *sessionPool // of the session, released on Close
 }
 
 type OCI8Tx struct {
@@ -413,17 +491,36 @@ type OCI8Tx struct {
 // It expects to receive a string in the form:
 // user:password@host:port/sid?param1=value1&param2=value2
 //
-// Currently the parameters supported is:
-// 1 'loc' which
-// sets the timezone to read times in as and to marshal to when writing times to
-// Oracle date,
-// 2 'isolation' =READONLY,SERIALIZABLE,DEFAULT
-// 3 'prefetch_rows'
-// 4 'prefetch_memory'
-// 5 'questionph' =YES,NO,TRUE,FALSE enable question-mark placeholders, default to false
+// The connect string after @ is either a tnsnames.ora alias, a connect
+// descriptor or in EZConnect Plus form, which is parsed into EZConnect.
+// EZConnect Plus options are given with the parameters of the query string.
+//
+// The parameters, their values and defaults, are documented by dsnParams in
+// params.go.
+//
+// A connect string with the server type POOLED, like host/service:pooled,
+// gets its session from DRCP, the database resident connection pool, by
+// OCISessionGet. For a tnsnames.ora alias, the driver sees the server type
+// when it finds the tnsnames.ora, see 'tns_admin'.
+//
+// The user appuser[enduser] connects as enduser through the proxy user
+// appuser, with the password of appuser, see EndUser.
+//
+// Unknown and duplicate parameters are ignored, unless 'strict' is set or
+// the DSN is parsed by ParseDSNStrict.
 func ParseDSN(dsnString string) (dsn *DSN, err error) {
+	return parseDSN(dsnString, false)
+}
+
+// ParseDSNStrict is like ParseDSN, but fails with a DSNError on unknown and
+// duplicate parameters.
+func ParseDSNStrict(dsnString string) (dsn *DSN, err error) {
+	return parseDSN(dsnString, true)
+}
 
-	dsn = &DSN{Location: time.Local}
+func parseDSN(dsnString string, strict bool) (dsn *DSN, err error) {
+
+	dsn = NewDSN()
 
 	if dsnString == "" {
 		return nil, errors.New("empty dsn")
@@ -441,6 +538,9 @@ func ParseDSN(dsnString string) (dsn *DSN, err error) {
 		if err != nil {
 			return nil, err
 		}
+		dsn.Username, dsn.EndUser = splitEndUser(dsn.Username)
+		// "/@connect" logs on with external credentials
+		dsn.external_auth = authority == "/"
 	}
 
 	host, params := splitRight(dsnString, "?")
@@ -450,79 +550,150 @@ func ParseDSN(dsnString string) (dsn *DSN, err error) {
 	}
 
 	dsn.Connect = host
-	// set safe defaults
-	dsn.prefetch_rows = 10
-	dsn.prefetch_memory = 0
-
-	qp, err := ParseQuery(params)
-	for k, v := range qp {
-		switch k {
-		case "loc":
-			if len(v) > 0 {
-				if dsn.Location, err = time.LoadLocation(v[0]); err != nil {
-					return nil, fmt.Errorf("Invalid loc: %v: %v", v[0], err)
-				}
-			}
-		case "isolation":
-			switch v[0] {
-			case "READONLY":
-				dsn.transactionMode = C.OCI_TRANS_READONLY
-			case "SERIALIZABLE":
-				dsn.transactionMode = C.OCI_TRANS_SERIALIZABLE
-			case "DEFAULT":
-				dsn.transactionMode = C.OCI_TRANS_READWRITE
-			default:
-				return nil, fmt.Errorf("Invalid isolation: %v", v[0])
-			}
-		case "questionph":
-			switch v[0] {
-			case "YES", "TRUE":
-				dsn.enableQMPlaceholders = true
-			case "NO", "FALSE":
-				dsn.enableQMPlaceholders = false
-			default:
-				return nil, fmt.Errorf("Invalid questionpm: %v", v[0])
-			}
-		case "prefetch_rows":
-			z, err := strconv.ParseUint(v[0], 10, 32)
-			if err != nil {
-				return nil, fmt.Errorf("invalid prefetch_rows: %v", v[0])
-			}
-			dsn.prefetch_rows = uint32(z)
-		case "prefetch_memory":
-			z, err := strconv.ParseUint(v[0], 10, 32)
-			if err != nil {
-				return nil, fmt.Errorf("invalid prefetch_memory: %v", v[0])
-			}
-			dsn.prefetch_memory = uint32(z)
-			//default:
-			//log.Println("unused parameter", k)
+	if strings.HasPrefix(host, "(") {
+		// catch unbalanced parentheses before OCI does
+		if dsn.Descriptor, err = ParseNVPair(host); err != nil {
+			return nil, err
+		}
+	} else if isEZConnect(host) {
+		if dsn.EZConnect, err = ParseEZConnect(host); err != nil {
+			return nil, err
+		}
+	}
 
+	if err = dsn.setParams(params, strict); err != nil {
+		return nil, err
+	}
+	if isTNSAlias(host) {
+		if dsn.Descriptor, err = dsn.resolveAlias(host); err != nil {
+			return nil, err
 		}
 	}
+	if dsn.wallet_location != "" && dsn.Descriptor == nil && dsn.EZConnect == nil {
+		return nil, &DSNError{Param: "wallet_location", Value: dsn.wallet_location,
+			Reason: "needs an EZConnect or descriptor connect string, or a tnsnames.ora to resolve " + host}
+	}
 	return dsn, nil
 }
 
+// splitEndUser splits appuser[enduser] into the proxy user and the end
+// user.
+func splitEndUser(s string) (user, endUser string) {
+	if i := strings.Index(s, "["); i >= 0 && strings.HasSuffix(s, "]") {
+		return s[:i], s[i+1 : len(s)-1]
+	}
+	return s, ""
+}
+
+// resolveAlias returns the connect descriptor of alias in the tnsnames.ora
+// of tns_admin, or else of $TNS_ADMIN or $ORACLE_HOME/network/admin. Without
+// tns_admin, when alias isn't found there or that tnsnames.ora can't be
+// read, it returns nil and OCI resolves the alias by its naming methods, such
+// as LDAP, or takes it for a host.
+func (dsn *DSN) resolveAlias(alias string) (*NVPair, error) {
+	if dsn.tns_admin != "" {
+		return ResolveTNSAlias(alias, dsn.tns_admin)
+	}
+	path, err := TNSNamesPath("")
+	if err != nil {
+		return nil, nil
+	}
+	t, err := ReadTNSNames(path)
+	if err != nil {
+		return nil, nil
+	}
+	nv, _ := t.Lookup(alias)
+	return nv, nil
+}
+
+// isTNSAlias reports whether the connect string s is a tnsnames.ora alias.
+func isTNSAlias(s string) bool {
+	return s != "" && !isEZConnect(s) && !strings.Contains(s, "(")
+}
+
+// connectString is the connect string given to oracle.
+func (dsn *DSN) connectString() string {
+	if dsn.Descriptor != nil {
+		if dsn.wallet_location != "" {
+			return withWallet(dsn.Descriptor, dsn.wallet_location).String()
+		}
+		if strings.HasPrefix(dsn.Connect, "(") {
+			// as given, with its quoting and formatting
+			return dsn.Connect
+		}
+		return dsn.Descriptor.String()
+	}
+	if dsn.EZConnect != nil {
+		if dsn.wallet_location != "" {
+			ez := *dsn.EZConnect
+			ez.Options = Values{}
+			for k, v := range dsn.EZConnect.Options {
+				ez.Options[k] = v
+			}
+			ez.Options.Set("wallet_location", dsn.wallet_location)
+			return ez.String()
+		}
+		return dsn.EZConnect.String()
+	}
+	return dsn.Connect
+}
+
+// withWallet returns a copy of the DESCRIPTION desc with the SECURITY
+// parameter MY_WALLET_DIRECTORY set to dir.
+func withWallet(desc *NVPair, dir string) *NVPair {
+	d := *desc
+	d.Children = nil
+	var security NVPair
+	for _, c := range desc.Children {
+		if strings.EqualFold(c.Name, "SECURITY") {
+			security = *c
+			continue
+		}
+		d.Children = append(d.Children, c)
+	}
+	security.Name = "SECURITY"
+	children := security.Children
+	security.Children = nil
+	for _, c := range children {
+		if !strings.EqualFold(c.Name, "MY_WALLET_DIRECTORY") {
+			security.Children = append(security.Children, c)
+		}
+	}
+	security.Children = append(security.Children, &NVPair{Name: "MY_WALLET_DIRECTORY", Value: dir})
+	d.Children = append(d.Children, &security)
+	return &d
+}
+
 func (tx *OCI8Tx) Commit() error {
 	tx.c.inTransaction = false
+	tx.c.savepoints = nil
+	cl, err := tx.c.startCall(context.Background())
+	if err != nil {
+		return err
+	}
 	if rv := C.OCITransCommit(
 		(*C.OCISvcCtx)(tx.c.svc),
 		(*C.OCIError)(tx.c.err),
 		0); rv != C.OCI_SUCCESS {
-		return ociGetError(rv, tx.c.err)
+		err = tx.c.timeoutError(ociGetError(rv, tx.c.err))
 	}
-	return nil
+	return cl.finish(err)
 }
 
 func (tx *OCI8Tx) Rollback() error {
 	tx.c.inTransaction = false
+	tx.c.savepoints = nil
+	cl, err := tx.c.startCall(context.Background())
+	if err != nil {
+		return err
+	}
 	if rv := C.OCITransRollback(
 		(*C.OCISvcCtx)(tx.c.svc),
 		(*C.OCIError)(tx.c.err),
 		0); rv != C.OCI_SUCCESS {
-		return ociGetError(rv, tx.c.err)
+		err = tx.c.timeoutError(ociGetError(rv, tx.c.err))
 	}
-	return nil
+	return cl.finish(err)
 }
 
 type namedValue struct {
@@ -549,10 +720,10 @@ func (c *OCI8Conn) Exec(query string, args []driver.Value) (driver.Result, error
 
 func (c *OCI8Conn) exec(ctx context.Context, query string, args []namedValue) (driver.Result, error) {
 	s, err := c.prepare(ctx, query)
-	defer s.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer s.Close()
 	res, err := s.(*OCI8Stmt).exec(ctx, args)
 	if err != nil && err != driver.ErrSkip {
 		return nil, err
@@ -606,48 +777,65 @@ func (c *OCI8Conn) query(ctx context.Context, query string, args []namedValue) (
 }
 
 func (c *OCI8Conn) ping(ctx context.Context) error {
+	cl, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
 	rv := C.OCIPing(
 		(*C.OCISvcCtx)(c.svc),
 		(*C.OCIError)(c.err),
 		C.OCI_DEFAULT)
 	if rv != C.OCI_SUCCESS {
-		return errors.New("ping failed")
+		// driver.ErrBadConn makes database/sql retry on another connection
+		err = c.timeoutError(ociGetError(rv, c.err))
+		if _, ok := err.(*TimeoutError); !ok && err != driver.ErrBadConn {
+			err = errors.New("ping failed")
+		}
 	}
-	return nil
+	return cl.finish(err)
 }
 
 func (c *OCI8Conn) Begin() (driver.Tx, error) {
-	return c.begin(context.Background())
+	return c.begin(context.Background(), c.transactionMode)
 }
 
-func (c *OCI8Conn) begin(ctx context.Context) (driver.Tx, error) {
-	if c.transactionMode != C.OCI_TRANS_READWRITE {
-		var th unsafe.Pointer
-		if rv := C.WrapOCIHandleAlloc(
-			c.env,
-			C.OCI_HTYPE_TRANS,
-			0); rv.rv != C.OCI_SUCCESS {
-			return nil, errors.New("can't allocate handle")
-		} else {
-			th = rv.ptr
+// begin starts a transaction in mode, one of OCI_TRANS_READWRITE,
+// OCI_TRANS_SERIALIZABLE or OCI_TRANS_READONLY.
+func (c *OCI8Conn) begin(ctx context.Context, mode C.ub4) (driver.Tx, error) {
+	if mode != C.OCI_TRANS_READWRITE {
+		cl, err := c.startCall(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if c.trans == nil {
+			if rv := C.WrapOCIHandleAlloc(
+				c.env,
+				C.OCI_HTYPE_TRANS,
+				0); rv.rv != C.OCI_SUCCESS {
+				return nil, cl.finish(errors.New("can't allocate handle"))
+			} else {
+				c.trans = rv.ptr
+			}
 		}
 		if rv := C.OCIAttrSet(
 			c.svc,
 			C.OCI_HTYPE_SVCCTX,
-			th,
+			c.trans,
 			0,
 			C.OCI_ATTR_TRANS,
 			(*C.OCIError)(c.err)); rv != C.OCI_SUCCESS {
-			return nil, ociGetError(rv, c.err)
+			return nil, cl.finish(ociGetError(rv, c.err))
 		}
-
 		if rv := C.OCITransStart(
 			(*C.OCISvcCtx)(c.svc),
 			(*C.OCIError)(c.err),
 			0,
-			c.transactionMode); // C.OCI_TRANS_SERIALIZABLE C.OCI_TRANS_READWRITE C.OCI_TRANS_READONLY
+			mode); // C.OCI_TRANS_SERIALIZABLE C.OCI_TRANS_READWRITE C.OCI_TRANS_READONLY
 		rv != C.OCI_SUCCESS {
-			return nil, ociGetError(rv, c.err)
+			err = c.timeoutError(ociGetError(rv, c.err))
+		}
+		if err = cl.finish(err); err != nil {
+			return nil, err
 		}
 	}
 	c.inTransaction = true
@@ -655,77 +843,288 @@ func (c *OCI8Conn) begin(ctx context.Context) (driver.Tx, error) {
 }
 
 func (d *OCI8Driver) Open(dsnString string) (connection driver.Conn, err error) {
-	var (
-		conn OCI8Conn
-		dsn  *DSN
-	)
+	dsn, err := ParseDSN(dsnString)
+	if err != nil {
+		return nil, err
+	}
+	return dsn.connect(context.Background())
+}
 
-	if dsn, err = ParseDSN(dsnString); err != nil {
+// connect logs on with dsn. OCILogon can't be interrupted, so when ctx is
+// done first the connection is closed as soon as the logon returns.
+func (dsn *DSN) connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	username, password, err := dsn.credentials(ctx)
+	if err != nil {
 		return nil, err
 	}
+	return logonContext(ctx, func() (driver.Conn, error) {
+		return dsn.logon(ctx, username, password)
+	})
+}
 
-	if rv := C.WrapOCIEnvCreate(
-		C.OCI_DEFAULT|C.OCI_THREADED,
-		0); rv.rv != C.OCI_SUCCESS && rv.rv != C.OCI_SUCCESS_WITH_INFO {
-		// TODO: error handle not yet allocated, we can't get string error from oracle
-		return nil, errors.New("can't OCIEnvCreate")
-	} else {
-		conn.env = rv.ptr
+// logonContext returns the connection of logon, or the error of ctx when it
+// is done first. A connection logged on after that is closed.
+func logonContext(ctx context.Context, logon func() (driver.Conn, error)) (driver.Conn, error) {
+	if ctx.Done() == nil {
+		return logon()
 	}
 
-	if rv := C.WrapOCIHandleAlloc(
-		conn.env,
+	type result struct {
+		conn driver.Conn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := logon()
+		done <- result{conn, err}
+	}()
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// sharedEnv is the environment of all connections, created by the first
+// and freed when the last is closed. Each connection has an error handle of
+// its own.
+var sharedEnv struct {
+	sync.Mutex
+	env  unsafe.Pointer
+	refs int
+}
+
+// acquireEnv returns the shared environment and a new error handle in it,
+// to be released by releaseEnv.
+func acquireEnv() (env, errh unsafe.Pointer, err error) {
+	sharedEnv.Lock()
+	defer sharedEnv.Unlock()
+	if sharedEnv.refs == 0 {
+		rv := C.WrapOCIEnvCreate(
+			C.OCI_DEFAULT|C.OCI_THREADED,
+			0)
+		if rv.rv != C.OCI_SUCCESS && rv.rv != C.OCI_SUCCESS_WITH_INFO {
+			// TODO: error handle not yet allocated, we can't get string error from oracle
+			return nil, nil, errors.New("can't OCIEnvCreate")
+		}
+		sharedEnv.env = rv.ptr
+	}
+	if errh, err = newErrorHandle(sharedEnv.env); err != nil {
+		if sharedEnv.refs == 0 {
+			C.OCIHandleFree(sharedEnv.env, C.OCI_HTYPE_ENV)
+			sharedEnv.env = nil
+		}
+		return nil, nil, err
+	}
+	sharedEnv.refs++
+	return sharedEnv.env, errh, nil
+}
+
+// releaseEnv frees the error handle errh of acquireEnv, and the shared
+// environment with the last reference.
+func releaseEnv(errh unsafe.Pointer) {
+	sharedEnv.Lock()
+	defer sharedEnv.Unlock()
+	C.OCIHandleFree(errh, C.OCI_HTYPE_ERROR)
+	if sharedEnv.refs--; sharedEnv.refs == 0 {
+		C.OCIHandleFree(sharedEnv.env, C.OCI_HTYPE_ENV)
+		sharedEnv.env = nil
+	}
+}
+
+// newErrorHandle allocates an error handle in env.
+func newErrorHandle(env unsafe.Pointer) (unsafe.Pointer, error) {
+	rv := C.WrapOCIHandleAlloc(
+		env,
 		C.OCI_HTYPE_ERROR,
-		0); rv.rv != C.OCI_SUCCESS {
+		0)
+	if rv.rv != C.OCI_SUCCESS {
 		return nil, errors.New("cant allocate error handle")
-	} else {
-		conn.err = rv.ptr
-	}
-
-	phost := C.CString(dsn.Connect)
-	defer C.free(unsafe.Pointer(phost))
-	puser := C.CString(dsn.Username)
-	defer C.free(unsafe.Pointer(puser))
-	ppass := C.CString(dsn.Password)
-	defer C.free(unsafe.Pointer(ppass))
-
-	if rv := C.WrapOCILogon(
-		(*C.OCIEnv)(conn.env),
-		(*C.OCIError)(conn.err),
-		(*C.OraText)(unsafe.Pointer(puser)),
-		C.ub4(len(dsn.Username)),
-		(*C.OraText)(unsafe.Pointer(ppass)),
-		C.ub4(len(dsn.Password)),
-		(*C.OraText)(unsafe.Pointer(phost)),
-		C.ub4(len(dsn.Connect))); rv.rv != C.OCI_SUCCESS && rv.rv != C.OCI_SUCCESS_WITH_INFO {
-		return nil, ociGetError(rv.rv, conn.err)
-	} else {
-		conn.svc = rv.ptr
 	}
+	return rv.ptr, nil
+}
+
+func (dsn *DSN) logon(ctx context.Context, username, password string) (driver.Conn, error) {
+	var conn OCI8Conn
+	var err error
+	if conn.env, conn.err, err = acquireEnv(); err != nil {
+		return nil, err
+	}
+
+	if dsn.pooledServer() {
+		if err := conn.drcpLogon(dsn, username, password); err != nil {
+			releaseEnv(conn.err)
+			return nil, err
+		}
+		if err := dsn.initConn(&conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return &conn, nil
+	}
+
+	p := &sessionParams{
+		connect:  dsn.connectString(),
+		username: username,
+		password: password,
+		cred:     C.OCI_CRED_RDBMS,
+		mode:     C.OCI_DEFAULT | dsn.privilege,
+	}
+	if dsn.external_auth {
+		p.cred = C.OCI_CRED_EXT
+	}
+	if dsn.EndUser != "" {
+		// the privilege is of the end user
+		p.mode = C.OCI_DEFAULT
+	}
+	switch rv := conn.sessionLogon(p); rv {
+	case C.OCI_SUCCESS:
+	case C.OCI_SUCCESS_WITH_INFO:
+		if oe, ok := ociGetErrorS(conn.err).(*OCI8Error); ok && oe.Code == 28002 && dsn.ChangePassword != nil {
+			// ORA-28002: the password will expire within n days
+			newPassword, err := dsn.ChangePassword(ctx, username, password, oe.Code)
+			if err == nil && newPassword != "" {
+				err = conn.changePassword(username, password, newPassword)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	default:
+		err := ociGetError(rv, conn.err)
+		if oe, ok := err.(*OCI8Error); ok && oe.Code == 28001 && dsn.ChangePassword != nil {
+			// ORA-28001: the password has expired
+			if p.newPassword, err = dsn.ChangePassword(ctx, username, password, oe.Code); err == nil {
+				err = oe
+				if p.newPassword != "" {
+					if rv = conn.sessionLogon(p); rv == C.OCI_SUCCESS || rv == C.OCI_SUCCESS_WITH_INFO {
+						err = nil
+					} else {
+						err = ociGetError(rv, conn.err)
+					}
+				}
+			}
+		}
+		if err != nil {
+			releaseEnv(conn.err)
+			return nil, err
+		}
+	}
+	if dsn.EndUser != "" {
+		var roles []string
+		for _, role := range strings.Split(dsn.proxy_roles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+		if err := conn.proxyLogon(dsn.EndUser, roles, C.OCI_DEFAULT|dsn.privilege); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err := dsn.initConn(&conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &conn, nil
+}
+
+// pooledServer reports whether the connect string asks for a DRCP pooled
+// server.
+func (dsn *DSN) pooledServer() bool {
+	if dsn.Descriptor != nil {
+		if cd := dsn.Descriptor.Child("CONNECT_DATA"); cd != nil {
+			if server := cd.Child("SERVER"); server != nil {
+				return strings.EqualFold(server.Value, "POOLED")
+			}
+		}
+		return false
+	}
+	return dsn.EZConnect != nil && strings.EqualFold(dsn.EZConnect.Server, "pooled")
+}
+
+// drcpLogon gets a session of DRCP by OCISessionGet.
+func (c *OCI8Conn) drcpLogon(dsn *DSN, username, password string) error {
+	mode, err := dsn.sessionGetMode(username, password)
+	if err != nil {
+		return err
+	}
+	var user *[2]string
+	if mode&C.OCI_SESSGET_CREDEXT == 0 {
+		user = &[2]string{username, password}
+	}
+	if rv := c.sessionGet(dsn.connectString(), user, dsn.pool_connection_class, mode); rv != C.OCI_SUCCESS && rv != C.OCI_SUCCESS_WITH_INFO {
+		return ociGetError(rv, c.err)
+	}
+	return nil
+}
+
+// initConn copies the settings of dsn to the connection, and sets the
+// statement cache size of its session.
+func (dsn *DSN) initConn(conn *OCI8Conn) error {
 	conn.location = dsn.Location
 	conn.transactionMode = dsn.transactionMode
 	conn.prefetch_rows = dsn.prefetch_rows
 	conn.prefetch_memory = dsn.prefetch_memory
+	conn.fetch_array_size = dsn.fetch_array_size
 	conn.enableQMPlaceholders = dsn.enableQMPlaceholders
-	return &conn, nil
+	conn.stmt_cache_size = dsn.stmt_cache_size
+	conn.reset_packages = dsn.reset_packages
+	conn.call_timeout = dsn.call_timeout
+	if dsn.stmt_cache_size > 0 {
+		if rv := C.WrapOCIAttrSetUb4(conn.svc, C.OCI_HTYPE_SVCCTX, C.ub4(dsn.stmt_cache_size), C.OCI_ATTR_STMTCACHESIZE, (*C.OCIError)(conn.err)); rv != C.OCI_SUCCESS {
+			return ociGetError(rv, conn.err)
+		}
+	}
+	return nil
 }
 
 func (c *OCI8Conn) Close() error {
+	// wait for the call in flight, if any
+	c.calls.Lock()
+	defer c.calls.Unlock()
 	if c.closed {
 		return nil
 	}
+	c.closeCursors()
 	c.closed = true
 
-	var err error
-	if rv := C.OCILogoff(
-		(*C.OCISvcCtx)(c.svc),
-		(*C.OCIError)(c.err)); rv != C.OCI_SUCCESS {
-		err = ociGetError(rv, c.err)
+	// take the transaction handles off the service context, which a pooled
+	// session keeps
+	c.xaRelease()
+	if c.trans != nil {
+		C.OCIAttrSet(
+			c.svc,
+			C.OCI_HTYPE_SVCCTX,
+			nil,
+			0,
+			C.OCI_ATTR_TRANS,
+			(*C.OCIError)(c.err))
+		C.OCIHandleFree(c.trans, C.OCI_HTYPE_TRANS)
+		c.trans = nil
 	}
 
-	C.OCIHandleFree(
-		c.env,
-		C.OCI_HTYPE_ENV)
+	var err error
+	if c.usr != nil {
+		err = c.endSession()
+	} else {
+		err = c.releaseSession()
+	}
+	releaseEnv(c.err)
+	if c.pool != nil {
+		c.pool.release()
+		c.pool = nil
+	}
 
 	c.svc = nil
 	c.env = nil
@@ -736,7 +1135,9 @@ func (c *OCI8Conn) Close() error {
 type OCI8Stmt struct {
 	c      *OCI8Conn
 	s      unsafe.Pointer
+	sql    string
 	closed bool
+	cached bool // prepared by OCIStmtPrepare2, released by OCIStmtRelease
 	bp     **C.OCIBind
 	defp   **C.OCIDefine
 	pbind  []oci8bind //bind params
@@ -750,8 +1151,21 @@ func (c *OCI8Conn) prepare(ctx context.Context, query string) (driver.Stmt, erro
 	if c.enableQMPlaceholders {
 		query = placeholders(query)
 	}
-	pquery := C.CString(query)
-	defer C.free(unsafe.Pointer(pquery))
+	c.calls.Lock()
+	defer c.calls.Unlock()
+	if c.closed {
+		return nil, driver.ErrBadConn
+	}
+	ss, err := c.prepareStmt(query)
+	if err != nil {
+		return nil, c.markBad(err)
+	}
+	return ss, nil
+}
+
+// allocStmt allocates a statement handle, with room for its bind and
+// define handles.
+func (c *OCI8Conn) allocStmt() (*OCI8Stmt, error) {
 	var s, bp, defp unsafe.Pointer
 
 	if rv := C.WrapOCIHandleAlloc(
@@ -765,34 +1179,37 @@ func (c *OCI8Conn) prepare(ctx context.Context, query string) (driver.Stmt, erro
 		defp = unsafe.Pointer(uintptr(rv.extra) + unsafe.Sizeof(unsafe.Pointer(nil)))
 	}
 
-	if rv := C.OCIStmtPrepare(
-		(*C.OCIStmt)(s),
-		(*C.OCIError)(c.err),
-		(*C.OraText)(unsafe.Pointer(pquery)),
-		C.ub4(C.strlen(pquery)),
-		C.ub4(C.OCI_NTV_SYNTAX),
-		C.ub4(C.OCI_DEFAULT)); rv != C.OCI_SUCCESS {
-		return nil, ociGetError(rv, c.err)
-	}
-
 	ss := &OCI8Stmt{c: c, s: s, bp: (**C.OCIBind)(bp), defp: (**C.OCIDefine)(defp)}
 	runtime.SetFinalizer(ss, (*OCI8Stmt).Close)
 	return ss, nil
 }
 
 func (s *OCI8Stmt) Close() error {
+	// wait for the call in flight on the connection, if any
+	s.c.calls.Lock()
+	defer s.c.calls.Unlock()
+	return s.close()
+}
+
+// close implements Close, with the calls of the connection held.
+func (s *OCI8Stmt) close() error {
 	if s.closed {
 		return nil
 	}
 	s.closed = true
 
 	runtime.SetFinalizer(s, nil)
-	C.OCIHandleFree(
-		s.s,
-		C.OCI_HTYPE_STMT)
+	var err error
+	if s.cached {
+		err = s.release()
+	} else {
+		C.OCIHandleFree(
+			s.s,
+			C.OCI_HTYPE_STMT)
+	}
 	s.s = nil
 	s.pbind = nil
-	return nil
+	return err
 }
 
 func (s *OCI8Stmt) NumInput() int {
@@ -805,8 +1222,35 @@ func (s *OCI8Stmt) NumInput() int {
 
 func freeBoundParameters(boundParameters []oci8bind) {
 	for _, col := range boundParameters {
-		if col.pbuf != nil {
+		if col.ind != nil {
+			C.free(unsafe.Pointer(col.ind))
+			col.ind = nil
+		}
+		if col.alen != nil {
+			C.free(unsafe.Pointer(col.alen))
+			col.alen = nil
+		}
+		if col.pbuf != nil && col.n > 0 {
+			if col.kind == C.SQLT_TIMESTAMP_TZ {
+				for i := 0; i < col.n; i++ {
+					if *(*unsafe.Pointer)(col.value(i)) != nil {
+						freeDecriptor(col.value(i), C.OCI_DTYPE_TIMESTAMP_TZ)
+					}
+				}
+			}
+			C.free(col.pbuf)
+			col.pbuf = nil
+		} else if col.pbuf != nil {
 			switch col.kind {
+			case C.SQLT_RSET:
+				if col.cursor != nil {
+					// a cursor not handed out as rows is only freed by
+					// OCIHandleFree, which uses no error handle of the
+					// connection, so close is called whether bind holds
+					// the calls or exec and query have finished theirs
+					col.cursor.close()
+				}
+				C.free(col.pbuf)
 			case C.SQLT_CLOB, C.SQLT_BLOB:
 				freeDecriptor(col.pbuf, C.OCI_DTYPE_LOB)
 			case C.SQLT_TIMESTAMP:
@@ -831,56 +1275,578 @@ func getInt64(p unsafe.Pointer) int64 {
 	return int64(*(*C.sb8)(p))
 }
 
-func outputBoundParameters(boundParameters []oci8bind) {
-	for _, col := range boundParameters {
-		if col.pbuf != nil {
-			switch v := col.out.(type) {
-			case *string:
-				*v = C.GoString((*C.char)(col.pbuf))
-			case *int:
-				*v = int(getInt64(col.pbuf))
-			case *int64:
-				*v = getInt64(col.pbuf)
-			case *int32:
-				*v = int32(getInt64(col.pbuf))
-			case *int16:
-				*v = int16(getInt64(col.pbuf))
-			case *int8:
-				*v = int8(getInt64(col.pbuf))
-
-			case *float64:
-
-				buf := (*[1 << 30]byte)(col.pbuf)[0:8]
-				f := uint64(buf[7])
-				f |= uint64(buf[6]) << 8
-				f |= uint64(buf[5]) << 16
-				f |= uint64(buf[4]) << 24
-				f |= uint64(buf[3]) << 32
-				f |= uint64(buf[2]) << 40
-				f |= uint64(buf[1]) << 48
-				f |= uint64(buf[0]) << 56
+func (s *OCI8Stmt) outputBoundParameters(ctx context.Context, boundParameters []oci8bind) error {
+	for i, col := range boundParameters {
+		if col.out == nil || col.pbuf == nil {
+			continue
+		}
+		if v, ok := col.out.(*driver.Rows); ok {
+			if err := col.cursor.setPrefetch(); err != nil {
+				return err
+			}
+			// the rows outlive the call, their fetches are not limited
+			// by its ctx
+			rows, err := col.cursor.newRows(context.Background(), s.c.fetchArraySize(ctx))
+			if err != nil {
+				return err
+			}
+			// closing the rows closes the cursor
+			rows.cls = true
+			boundParameters[i].cursor = nil
+			if s.c.cursors == nil {
+				s.c.cursors = make(map[*OCI8Rows]struct{})
+			}
+			s.c.cursors[rows] = struct{}{}
+			*v = rows
+			continue
+		}
 
-				// Don't know why bits are inverted that way, but it works
-				if buf[0]&0x80 == 0 {
-					f ^= 0xffffffffffffffff
-				} else {
-					f &= 0x7fffffffffffffff
+		null := *col.ind == -1
+		switch v := col.out.(type) {
+		case *OutString:
+			*v.Value = ""
+			if !null {
+				*v.Value = col.string()
+			}
+		case *sql.NullString:
+			v.String, v.Valid = "", !null
+			if !null {
+				v.String = col.string()
+			}
+		case *sql.NullInt64:
+			v.Int64, v.Valid = 0, !null
+			if !null {
+				v.Int64 = getInt64(col.pbuf)
+			}
+		case *sql.NullFloat64:
+			v.Float64, v.Valid = 0, !null
+			if !null {
+				v.Float64 = fromIbdouble(col.pbuf)
+			}
+		case *sql.NullBool:
+			v.Bool, v.Valid = false, !null
+			if !null {
+				v.Bool = getInt64(col.pbuf) != 0
+			}
+		case *[]byte:
+			*v = nil
+			if !null {
+				*v = C.GoBytes(col.pbuf, C.int(*col.alen))
+			}
+		case *time.Time:
+			*v = time.Time{}
+			if !null {
+				t, err := s.c.ociTime(*(**C.OCIDateTime)(col.pbuf))
+				if err != nil {
+					return err
+				}
+				*v = t
+			}
+		default:
+			e := reflect.ValueOf(col.out).Elem()
+			switch e.Kind() {
+			case reflect.String:
+				e.SetString("")
+				if !null {
+					e.SetString(col.string())
+				}
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				e.SetInt(0)
+				if !null {
+					e.SetInt(getInt64(col.pbuf))
+				}
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				e.SetUint(0)
+				if !null {
+					v := getInt64(col.pbuf)
+					if v < 0 || e.OverflowUint(uint64(v)) {
+						return fmt.Errorf("oci8: output parameter %d is %d, out of range for %v", i+1, v, e.Type())
+					}
+					e.SetUint(uint64(v))
+				}
+			case reflect.Float32, reflect.Float64:
+				e.SetFloat(0)
+				if !null {
+					e.SetFloat(fromIbdouble(col.pbuf))
+				}
+			case reflect.Bool:
+				e.SetBool(false)
+				if !null {
+					e.SetBool(getInt64(col.pbuf) != 0)
 				}
-
-				*v = math.Float64frombits(f)
-
-			case *bool:
-				buf := (*[1 << 30]byte)(col.pbuf)[0:1]
-				*v = buf[0] != 0
 			}
 		}
 	}
+	return nil
 }
 
-func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
-	if len(args) == 0 {
+// OutString is an output destination for sql.Out receiving a string of up
+// to Size bytes, or defaultOutSize when Size is 0. A plain *string
+// destination gets a buffer of defaultOutSize bytes, a *[]byte one of its
+// capacity when greater.
+//
+//	db.Exec("begin :1 := get_name(); end;", sql.Out{Dest: &oci8.OutString{Value: &name, Size: 100}})
+type OutString struct {
+	Value *string
+	Size  int
+}
+
+const (
+	defaultOutSize = 4000  // output buffer for strings and []byte
+	maxOutSize     = 32767 // max size of PL/SQL VARCHAR2 and RAW
+)
+
+// bindOut allocates the output buffer for out, sized by the type of its
+// destination. Unless out.In is set, the parameter is bound as NULL.
+func (s *OCI8Stmt) bindOut(b *oci8bind, out outValue) error {
+	b.out = out.Dest
+
+	switch d := out.Dest.(type) {
+	case *driver.Rows: // REF CURSOR
+		var err error
+		if b.cursor, err = s.c.allocStmt(); err != nil {
+			return err
+		}
+		b.kind = C.SQLT_RSET
+		b.pbuf = C.malloc(C.size_t(unsafe.Sizeof(unsafe.Pointer(nil))))
+		*(*unsafe.Pointer)(b.pbuf) = b.cursor.s
+		return nil
+	case *OutString:
+		if d.Value == nil {
+			return errors.New("oci8: OutString.Value is nil")
+		}
+		size := d.Size
+		if size <= 0 {
+			size = defaultOutSize
+		}
+		if size > maxOutSize {
+			return fmt.Errorf("oci8: output string size %d exceeds %d", size, maxOutSize)
+		}
+		b.alloc(C.SQLT_CHR, size)
+		if out.In {
+			b.setBytes([]byte(*d.Value))
+		}
+		return nil
+	case *sql.NullString:
+		b.alloc(C.SQLT_CHR, defaultOutSize)
+		if out.In && d.Valid {
+			b.setBytes([]byte(d.String))
+		}
+		return nil
+	case *sql.NullInt64:
+		b.alloc(C.SQLT_INT, 8)
+		if out.In && d.Valid {
+			b.setInt(d.Int64)
+		}
+		return nil
+	case *sql.NullFloat64:
+		b.alloc(C.SQLT_IBDOUBLE, 8)
+		if out.In && d.Valid {
+			b.setFloat(d.Float64)
+		}
+		return nil
+	case *sql.NullBool:
+		b.alloc(C.SQLT_INT, 8)
+		if out.In && d.Valid {
+			b.setBool(d.Bool)
+		}
+		return nil
+	case *[]byte:
+		// room for the input and what PL/SQL adds to it
+		size := cap(*d)
+		if size < defaultOutSize {
+			size = defaultOutSize
+		}
+		if size > maxOutSize {
+			return fmt.Errorf("oci8: output []byte size %d exceeds %d", size, maxOutSize)
+		}
+		b.alloc(C.SQLT_BIN, size)
+		if out.In && *d != nil {
+			b.setBytes(*d)
+		}
+		return nil
+	case *time.Time:
+		ret := C.WrapOCIDescriptorAlloc(
+			s.c.env,
+			C.OCI_DTYPE_TIMESTAMP_TZ,
+			C.size_t(unsafe.Sizeof(unsafe.Pointer(nil))))
+		if ret.rv != C.OCI_SUCCESS {
+			return ociGetError(ret.rv, s.c.err)
+		}
+		b.kind = C.SQLT_TIMESTAMP_TZ
+		b.clen = C.sb4(unsafe.Sizeof(unsafe.Pointer(nil)))
+		b.pbuf = ret.extra
+		*(*unsafe.Pointer)(ret.extra) = ret.ptr
+		b.ind = (*C.sb2)(C.malloc(C.size_t(unsafe.Sizeof(C.sb2(0)))))
+		*b.ind = -1
+		if out.In {
+			if err := s.c.ociDateTime((*C.OCIDateTime)(ret.ptr), *d); err != nil {
+				return err
+			}
+			*b.ind = 0
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(out.Dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("oci8: unsupported output destination %T", out.Dest)
+	}
+	e := rv.Elem()
+	switch e.Kind() {
+	case reflect.String:
+		b.alloc(C.SQLT_CHR, defaultOutSize)
+		if out.In {
+			b.setBytes([]byte(e.String()))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b.alloc(C.SQLT_INT, 8)
+		if out.In {
+			b.setInt(e.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.alloc(C.SQLT_INT, 8)
+		if out.In {
+			u := e.Uint()
+			if u > math.MaxInt64 {
+				return fmt.Errorf("oci8: output parameter value %d is greater than %d", u, int64(math.MaxInt64))
+			}
+			b.setInt(int64(u))
+		}
+	case reflect.Float32, reflect.Float64:
+		b.alloc(C.SQLT_IBDOUBLE, 8)
+		if out.In {
+			b.setFloat(e.Float())
+		}
+	case reflect.Bool: // oracle dont have bool, handle as 0/1
+		b.alloc(C.SQLT_INT, 8)
+		if out.In {
+			b.setBool(e.Bool())
+		}
+	default:
+		return fmt.Errorf("oci8: unsupported output destination %T", out.Dest)
+	}
+	return nil
+}
+
+// alloc allocates a NULL in/out buffer of size bytes.
+func (b *oci8bind) alloc(kind C.ub2, size int) {
+	b.kind = kind
+	b.clen = C.sb4(size)
+	b.pbuf = C.malloc(C.size_t(size))
+	b.ind = (*C.sb2)(C.malloc(C.size_t(unsafe.Sizeof(C.sb2(0)))))
+	b.alen = (*C.ub2)(C.malloc(C.size_t(unsafe.Sizeof(C.ub2(0)))))
+	*b.ind = -1
+	*b.alen = C.ub2(size)
+}
+
+func (b *oci8bind) setBytes(v []byte) {
+	n := copy((*[1 << 30]byte)(b.pbuf)[0:int(b.clen)], v)
+	*b.alen = C.ub2(n)
+	*b.ind = 0
+}
+
+func (b *oci8bind) setInt(v int64) {
+	*(*C.sb8)(b.pbuf) = C.sb8(v)
+	*b.ind = 0
+}
+
+func (b *oci8bind) setBool(v bool) {
+	if v {
+		b.setInt(1)
+	} else {
+		b.setInt(0)
+	}
+}
+
+func (b *oci8bind) setFloat(v float64) {
+	fb := ibdouble(v)
+	copy((*[8]byte)(b.pbuf)[:], fb[:])
+	*b.ind = 0
+}
+
+// string returns the string written to an output buffer.
+func (b *oci8bind) string() string {
+	return C.GoStringN((*C.char)(b.pbuf), C.int(*b.alen))
+}
+
+// fromIbdouble decodes oracle's canonical BINARY_DOUBLE format.
+func fromIbdouble(p unsafe.Pointer) float64 {
+	buf := (*[1 << 30]byte)(p)[0:8]
+	f := uint64(buf[7])
+	f |= uint64(buf[6]) << 8
+	f |= uint64(buf[5]) << 16
+	f |= uint64(buf[4]) << 24
+	f |= uint64(buf[3]) << 32
+	f |= uint64(buf[2]) << 40
+	f |= uint64(buf[1]) << 48
+	f |= uint64(buf[0]) << 56
+
+	// Don't know why bits are inverted that way, but it works
+	if buf[0]&0x80 == 0 {
+		f ^= 0xffffffffffffffff
+	} else {
+		f &= 0x7fffffffffffffff
+	}
+
+	return math.Float64frombits(f)
+}
+
+// ociTime converts a TIMESTAMP WITH TIME ZONE to time.Time.
+func (c *OCI8Conn) ociTime(tptr *C.OCIDateTime) (time.Time, error) {
+	rv := C.WrapOCIDateTimeGetDateTime(
+		(*C.OCIEnv)(c.env),
+		(*C.OCIError)(c.err),
+		tptr)
+	if rv.rv != C.OCI_SUCCESS {
+		return time.Time{}, ociGetError(rv.rv, c.err)
+	}
+	rvz := C.WrapOCIDateTimeGetTimeZoneNameOffset(
+		(*C.OCIEnv)(c.env),
+		(*C.OCIError)(c.err),
+		tptr)
+	if rvz.rv != C.OCI_SUCCESS {
+		return time.Time{}, ociGetError(rvz.rv, c.err)
+	}
+	nnn := C.GoStringN((*C.char)((unsafe.Pointer)(&rvz.zone[0])), C.int(rvz.zlen))
+	loc, err := time.LoadLocation(nnn)
+	if err != nil {
+		// TODO: reuse locations
+		loc = time.FixedZone(nnn, int(rvz.h)*60*60+int(rvz.m)*60)
+	}
+	return time.Date(
+		int(rv.y),
+		time.Month(rv.m),
+		int(rv.d),
+		int(rv.hh),
+		int(rv.mm),
+		int(rv.ss),
+		int(rv.ff),
+		loc), nil
+}
+
+// ibdouble encodes v in oracle's canonical BINARY_DOUBLE format.
+func ibdouble(v float64) [8]byte {
+	fb := math.Float64bits(v)
+	if fb&0x8000000000000000 != 0 {
+		fb ^= 0xffffffffffffffff
+	} else {
+		fb |= 0x8000000000000000
+	}
+	return [8]byte{byte(fb >> 56), byte(fb >> 48), byte(fb >> 40), byte(fb >> 32), byte(fb >> 24), byte(fb >> 16), byte(fb >> 8), byte(fb)}
+}
+
+func (c *OCI8Conn) dateTimeConstruct(dt *C.OCIDateTime, t time.Time, zone string) C.sword {
+	zp := C.CString(zone)
+	defer C.free(unsafe.Pointer(zp))
+	return C.OCIDateTimeConstruct(
+		c.env,
+		(*C.OCIError)(c.err),
+		dt,
+		C.sb2(t.Year()),
+		C.ub1(t.Month()),
+		C.ub1(t.Day()),
+		C.ub1(t.Hour()),
+		C.ub1(t.Minute()),
+		C.ub1(t.Second()),
+		C.ub4(t.Nanosecond()),
+		(*C.OraText)(unsafe.Pointer(zp)),
+		C.size_t(len(zone)),
+	)
+}
+
+// ociDateTime sets dt to t. If oracle doesn't know the zone name of t, or
+// its offset differs from ours, the zone is given as "[+-]hh:mm" instead.
+func (c *OCI8Conn) ociDateTime(dt *C.OCIDateTime, t time.Time) error {
+	zone, offset := t.Zone()
+
+	tryagain := false
+	if rv := c.dateTimeConstruct(dt, t, zone); rv != C.OCI_SUCCESS {
+		tryagain = true
+	} else {
+		//check if oracle timezone offset is same ?
+		rvz := C.WrapOCIDateTimeGetTimeZoneNameOffset(
+			(*C.OCIEnv)(c.env),
+			(*C.OCIError)(c.err),
+			dt)
+		if rvz.rv != C.OCI_SUCCESS {
+			return ociGetError(rvz.rv, c.err)
+		}
+		if offset != int(rvz.h)*60*60+int(rvz.m)*60 {
+			//fmt.Println("oracle timezone offset dont match", zone, offset, int(rvz.h)*60*60+int(rvz.m)*60)
+			tryagain = true
+		}
+	}
+
+	if tryagain {
+		sign := '+'
+		if offset < 0 {
+			offset = -offset
+			sign = '-'
+		}
+		offset /= 60
+		// oracle accept zones "[+-]hh:mm", try second time
+		zone = fmt.Sprintf("%c%02d:%02d", sign, offset/60, offset%60)
+		if rv := c.dateTimeConstruct(dt, t, zone); rv != C.OCI_SUCCESS {
+			return ociGetError(rv, c.err)
+		}
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// arrayLen reports whether v is a slice which is bound as an array, one
+// element per execution of the statement, and returns its length. Byte
+// slices, like json.RawMessage, are one RAW value and not arrays.
+func arrayLen(v driver.Value) (int, bool) {
+	if _, ok := v.([]byte); ok || v == nil {
+		return 0, false
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return 0, false
+	}
+	et := rv.Type().Elem()
+	switch et.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Bool, reflect.String:
+	case reflect.Slice:
+		if et.Elem().Kind() != reflect.Uint8 {
+			return 0, false
+		}
+	default:
+		if et != timeType {
+			return 0, false
+		}
+	}
+	return rv.Len(), true
+}
+
+// arrayBindSize returns the number of iterations needed to execute a
+// statement with args. All arguments must be arrays of the same length, or
+// none of them.
+func arrayBindSize(args []namedValue) (n int, array bool, err error) {
+	for i, arg := range args {
+		l, ok := arrayLen(arg.Value)
+		if i > 0 && ok != array {
+			return 0, false, errors.New("oci8: can't mix array and scalar arguments")
+		}
+		if ok && i > 0 && l != n {
+			return 0, false, fmt.Errorf("oci8: array arguments differ in length: %d and %d", n, l)
+		}
+		n, array = l, ok
+	}
+	return n, array, nil
+}
+
+// bindArray fills b with the n elements of slice v.
+func (s *OCI8Stmt) bindArray(b *oci8bind, v interface{}, n int) error {
+	rv := reflect.ValueOf(v)
+	et := rv.Type().Elem()
+	b.n = n
+
+	if et == timeType {
+		b.kind = C.SQLT_TIMESTAMP_TZ
+		b.clen = C.sb4(unsafe.Sizeof(unsafe.Pointer(nil)))
+		b.pbuf = C.calloc(C.size_t(n), C.size_t(b.clen))
+		for i := 0; i < n; i++ {
+			ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_TIMESTAMP_TZ, 0)
+			if ret.rv != C.OCI_SUCCESS {
+				return ociGetError(ret.rv, s.c.err)
+			}
+			*(*unsafe.Pointer)(b.value(i)) = ret.ptr
+			if err := s.c.ociDateTime((*C.OCIDateTime)(ret.ptr), rv.Index(i).Interface().(time.Time)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch et.Kind() {
+	case reflect.String, reflect.Slice:
+		if et.Kind() == reflect.String {
+			b.kind = C.SQLT_AFC // don't trim strings !!!
+		} else {
+			b.kind = C.SQLT_BIN
+		}
+		size := 1
+		for i := 0; i < n; i++ {
+			l := rv.Index(i).Len()
+			if l > math.MaxUint16 {
+				return fmt.Errorf("oci8: array element %d is %d bytes, longer than %d", i, l, math.MaxUint16)
+			}
+			if l > size {
+				size = l
+			}
+		}
+		b.clen = C.sb4(size)
+		b.pbuf = C.malloc(C.size_t(n * size))
+		b.alen = (*C.ub2)(C.malloc(C.size_t(n) * C.size_t(unsafe.Sizeof(C.ub2(0)))))
+		alen := (*[1 << 28]C.ub2)(unsafe.Pointer(b.alen))[0:n]
+		for i := 0; i < n; i++ {
+			e := rv.Index(i)
+			var l int
+			if e.Kind() == reflect.String {
+				l = copy((*[1 << 30]byte)(b.value(i))[0:size], e.String())
+			} else {
+				l = copy((*[1 << 30]byte)(b.value(i))[0:size], e.Bytes())
+			}
+			alen[i] = C.ub2(l)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		b.kind = C.SQLT_IBDOUBLE
+		b.clen = 8
+		b.pbuf = C.malloc(C.size_t(n * 8))
+		for i := 0; i < n; i++ {
+			fb := ibdouble(rv.Index(i).Float())
+			copy((*[8]byte)(b.value(i))[:], fb[:])
+		}
+
+	case reflect.Bool: // oracle dont have bool, handle as 0/1
+		b.kind = C.SQLT_INT
+		b.clen = 1
+		b.pbuf = C.malloc(C.size_t(n))
+		for i := 0; i < n; i++ {
+			if rv.Index(i).Bool() {
+				*(*byte)(b.value(i)) = 1
+			} else {
+				*(*byte)(b.value(i)) = 0
+			}
+		}
+
+	case reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		b.kind = C.SQLT_INT
+		b.clen = 8
+		b.pbuf = C.malloc(C.size_t(n * 8))
+		for i := 0; i < n; i++ {
+			u := rv.Index(i).Uint()
+			if u > math.MaxInt64 {
+				return fmt.Errorf("oci8: array element %d is %d, greater than %d", i, u, int64(math.MaxInt64))
+			}
+			*(*C.sb8)(b.value(i)) = C.sb8(u)
+		}
+
+	default:
+		b.kind = C.SQLT_INT
+		b.clen = 8
+		b.pbuf = C.malloc(C.size_t(n * 8))
+		for i := 0; i < n; i++ {
+			*(*C.sb8)(b.value(i)) = C.sb8(rv.Index(i).Int())
+		}
+	}
+	return nil
+}
+
+func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
+	if len(args) == 0 {
 		return nil, nil
 	}
+	// the binds use the error handle of the connection
+	s.c.calls.Lock()
+	defer s.c.calls.Unlock()
 
 	var (
 		boundParameters []oci8bind
@@ -891,16 +1857,12 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 		var sbind oci8bind
 
 		vv := uv.Value
-		if out, ok := vv.(outValue); ok {
-			sbind.out = out.Dest
-			vv, err = driver.DefaultParameterConverter.ConvertValue(out.Dest)
-			if err != nil {
-				defer freeBoundParameters(boundParameters)
+		switch v := vv.(type) {
+		case outValue:
+			if err = s.bindOut(&sbind, v); err != nil {
+				defer freeBoundParameters(append(boundParameters, sbind))
 				return nil, err
 			}
-		}
-
-		switch v := vv.(type) {
 		case nil:
 			sbind.kind = C.SQLT_STR
 			sbind.pbuf = nil
@@ -911,110 +1873,29 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 			sbind.clen = C.sb4(len(v))
 
 		case float64:
-			fb := math.Float64bits(v)
-			if fb&0x8000000000000000 != 0 {
-				fb ^= 0xffffffffffffffff
-			} else {
-				fb |= 0x8000000000000000
-			}
+			fb := ibdouble(v)
 			sbind.kind = C.SQLT_IBDOUBLE
-			sbind.pbuf = unsafe.Pointer(CByte([]byte{byte(fb >> 56), byte(fb >> 48), byte(fb >> 40), byte(fb >> 32), byte(fb >> 24), byte(fb >> 16), byte(fb >> 8), byte(fb)}))
+			sbind.pbuf = unsafe.Pointer(CByte(fb[:]))
 			sbind.clen = 8
 
 		case time.Time:
-
-			var pt unsafe.Pointer
-			var zp unsafe.Pointer
-
-			zone, offset := v.Zone()
-
-			size := len(zone)
-			if size < 8 {
-				size = 8
-			}
-			size += int(unsafe.Sizeof(unsafe.Pointer(nil)))
 			if ret := C.WrapOCIDescriptorAlloc(
 				s.c.env,
 				C.OCI_DTYPE_TIMESTAMP_TZ,
-				C.size_t(size)); ret.rv != C.OCI_SUCCESS {
+				C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)))); ret.rv != C.OCI_SUCCESS {
 				defer freeBoundParameters(boundParameters)
 				return nil, ociGetError(ret.rv, s.c.err)
 			} else {
 				sbind.kind = C.SQLT_TIMESTAMP_TZ
-				sbind.clen = C.sb4(unsafe.Sizeof(pt))
-				pt = ret.extra
+				sbind.clen = C.sb4(unsafe.Sizeof(unsafe.Pointer(nil)))
+				sbind.pbuf = ret.extra
 				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-				zp = unsafe.Pointer(uintptr(ret.extra) + unsafe.Sizeof(unsafe.Pointer(nil)))
-			}
-
-			tryagain := false
-
-			copy((*[1 << 30]byte)(zp)[0:len(zone)], zone)
-			rv := C.OCIDateTimeConstruct(
-				s.c.env,
-				(*C.OCIError)(s.c.err),
-				(*C.OCIDateTime)(*(*unsafe.Pointer)(pt)),
-				C.sb2(v.Year()),
-				C.ub1(v.Month()),
-				C.ub1(v.Day()),
-				C.ub1(v.Hour()),
-				C.ub1(v.Minute()),
-				C.ub1(v.Second()),
-				C.ub4(v.Nanosecond()),
-				(*C.OraText)(zp),
-				C.size_t(len(zone)),
-			)
-			if rv != C.OCI_SUCCESS {
-				tryagain = true
-			} else {
-				//check if oracle timezone offset is same ?
-				rvz := C.WrapOCIDateTimeGetTimeZoneNameOffset(
-					(*C.OCIEnv)(s.c.env),
-					(*C.OCIError)(s.c.err),
-					(*C.OCIDateTime)(*(*unsafe.Pointer)(pt)))
-				if rvz.rv != C.OCI_SUCCESS {
-					defer freeBoundParameters(boundParameters)
-					return nil, ociGetError(rvz.rv, s.c.err)
-				}
-				if offset != int(rvz.h)*60*60+int(rvz.m)*60 {
-					//fmt.Println("oracle timezone offset dont match", zone, offset, int(rvz.h)*60*60+int(rvz.m)*60)
-					tryagain = true
-				}
 			}
-
-			if tryagain {
-				sign := '+'
-				if offset < 0 {
-					offset = -offset
-					sign = '-'
-				}
-				offset /= 60
-				// oracle accept zones "[+-]hh:mm", try second time
-				zone = fmt.Sprintf("%c%02d:%02d", sign, offset/60, offset%60)
-
-				copy((*[1 << 30]byte)(zp)[0:len(zone)], zone)
-				rv := C.OCIDateTimeConstruct(
-					s.c.env,
-					(*C.OCIError)(s.c.err),
-					(*C.OCIDateTime)(*(*unsafe.Pointer)(pt)),
-					C.sb2(v.Year()),
-					C.ub1(v.Month()),
-					C.ub1(v.Day()),
-					C.ub1(v.Hour()),
-					C.ub1(v.Minute()),
-					C.ub1(v.Second()),
-					C.ub4(v.Nanosecond()),
-					(*C.OraText)(zp),
-					C.size_t(len(zone)),
-				)
-				if rv != C.OCI_SUCCESS {
-					defer freeBoundParameters(boundParameters)
-					return nil, ociGetError(rv, s.c.err)
-				}
+			if err = s.c.ociDateTime(*(**C.OCIDateTime)(sbind.pbuf), v); err != nil {
+				defer freeBoundParameters(append(boundParameters, sbind))
+				return nil, err
 			}
 
-			sbind.pbuf = unsafe.Pointer((*C.char)(pt))
-
 		case string:
 			sbind.kind = C.SQLT_AFC // don't trim strings !!!
 			sbind.pbuf = unsafe.Pointer(C.CString(v))
@@ -1045,8 +1926,11 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 			}
 
 		default:
-			if sbind.out != nil {
-				sbind.kind = C.SQLT_STR
+			if n, ok := arrayLen(v); ok {
+				if err = s.bindArray(&sbind, v, n); err != nil {
+					defer freeBoundParameters(append(boundParameters, sbind))
+					return nil, err
+				}
 			} else {
 				sbind.kind = C.SQLT_CHR
 				d := fmt.Sprintf("%v", v)
@@ -1068,8 +1952,8 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 				unsafe.Pointer(sbind.pbuf),
 				sbind.clen,
 				sbind.kind,
-				nil,
-				nil,
+				unsafe.Pointer(sbind.ind),
+				sbind.alen,
 				nil,
 				0,
 				nil,
@@ -1084,8 +1968,8 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 				unsafe.Pointer(sbind.pbuf),
 				sbind.clen,
 				sbind.kind,
-				nil,
-				nil,
+				unsafe.Pointer(sbind.ind),
+				sbind.alen,
 				nil,
 				0,
 				nil,
@@ -1094,6 +1978,18 @@ func (s *OCI8Stmt) bind(args []namedValue) ([]oci8bind, error) {
 				return nil, ociGetError(rv, s.c.err)
 			}
 		}
+		if sbind.n > 0 {
+			if rv := C.OCIBindArrayOfStruct(
+				*s.bp,
+				(*C.OCIError)(s.c.err),
+				C.ub4(sbind.clen),
+				0,
+				C.ub4(unsafe.Sizeof(C.ub2(0))),
+				0); rv != C.OCI_SUCCESS {
+				defer freeBoundParameters(append(boundParameters, sbind))
+				return nil, ociGetError(rv, s.c.err)
+			}
+		}
 		boundParameters = append(boundParameters, sbind)
 	}
 	return boundParameters, nil
@@ -1116,6 +2012,12 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 		err error
 	)
 
+	if _, array, err := arrayBindSize(args); err != nil {
+		return nil, err
+	} else if array {
+		return nil, errors.New("oci8: array arguments can't be used with query")
+	}
+
 	if fbp, err = s.bind(args); err != nil {
 		return nil, err
 	}
@@ -1129,25 +2031,18 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 		iter = 0
 	}
 
-	// set the row prefetch.  Only one extra row per fetch will be returned unless this is set.
-	if s.c.prefetch_rows > 0 {
-		if rv := C.WrapOCIAttrSetUb4(s.s, C.OCI_HTYPE_STMT, C.ub4(s.c.prefetch_rows), C.OCI_ATTR_PREFETCH_ROWS, (*C.OCIError)(s.c.err)); rv != C.OCI_SUCCESS {
-			return nil, ociGetError(rv, s.c.err)
-		}
-	}
-
-	// if non-zero, oci will fetch rows until the memory limit or row prefetch limit is hit.
-	// useful for memory constrained systems
-	if s.c.prefetch_memory > 0 {
-		if rv := C.WrapOCIAttrSetUb4(s.s, C.OCI_HTYPE_STMT, C.ub4(s.c.prefetch_memory), C.OCI_ATTR_PREFETCH_MEMORY, (*C.OCIError)(s.c.err)); rv != C.OCI_SUCCESS {
-			return nil, ociGetError(rv, s.c.err)
-		}
+	if err = s.setPrefetch(); err != nil {
+		return nil, err
 	}
 
 	mode := C.ub4(C.OCI_DEFAULT)
 	if !s.c.inTransaction {
 		mode = mode | C.OCI_COMMIT_ON_SUCCESS
 	}
+	cl, err := s.c.startCall(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if rv := C.OCIStmtExecute(
 		(*C.OCISvcCtx)(s.c.svc),
 		(*C.OCIStmt)(s.s),
@@ -1157,9 +2052,40 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 		nil,
 		nil,
 		mode); rv != C.OCI_SUCCESS {
-		return nil, ociGetError(rv, s.c.err)
+		err = s.c.timeoutError(withSQL(ociGetError(rv, s.c.err), s.sql))
+	}
+	if err = cl.finish(err); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.newRows(ctx, s.c.fetchArraySize(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (s *OCI8Stmt) setPrefetch() error {
+	// set the row prefetch.  Only one extra row per fetch will be returned unless this is set.
+	if s.c.prefetch_rows > 0 {
+		if rv := C.WrapOCIAttrSetUb4(s.s, C.OCI_HTYPE_STMT, C.ub4(s.c.prefetch_rows), C.OCI_ATTR_PREFETCH_ROWS, (*C.OCIError)(s.c.err)); rv != C.OCI_SUCCESS {
+			return ociGetError(rv, s.c.err)
+		}
+	}
+
+	// if non-zero, oci will fetch rows until the memory limit or row prefetch limit is hit.
+	// useful for memory constrained systems
+	if s.c.prefetch_memory > 0 {
+		if rv := C.WrapOCIAttrSetUb4(s.s, C.OCI_HTYPE_STMT, C.ub4(s.c.prefetch_memory), C.OCI_ATTR_PREFETCH_MEMORY, (*C.OCIError)(s.c.err)); rv != C.OCI_SUCCESS {
+			return ociGetError(rv, s.c.err)
+		}
 	}
+	return nil
+}
 
+// newRows defines the columns of the executed statement s, fetching
+// fetchSize rows per round trip.
+func (s *OCI8Stmt) newRows(ctx context.Context, fetchSize int) (*OCI8Rows, error) {
 	var rc int
 	if retUb2 := C.WrapOCIAttrGetUb2(s.s, C.OCI_HTYPE_STMT, C.OCI_ATTR_PARAM_COUNT, (*C.OCIError)(s.c.err)); retUb2.rv != C.OCI_SUCCESS {
 		return nil, ociGetError(retUb2.rv, s.c.err)
@@ -1167,33 +2093,42 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 		rc = int(retUb2.num)
 	}
 
+	if fetchSize < 1 {
+		fetchSize = 1
+	} else if fetchSize > maxFetchArraySize {
+		fetchSize = maxFetchArraySize
+	}
+
 	oci8cols := make([]oci8col, rc)
-	indrlenptr := C.calloc(C.size_t(rc), C.sizeof_indrlen)
-	indrlen := (*[1 << 16]C.indrlen)(indrlenptr)[0:rc]
+	var indrlenptr unsafe.Pointer
 	for i := 0; i < rc; i++ {
 		var p unsafe.Pointer
 		var tp C.ub2
 		var lp C.ub2
 
 		if rp := C.WrapOCIParamGet(s.s, C.OCI_HTYPE_STMT, (*C.OCIError)(s.c.err), C.ub4(i+1)); rp.rv != C.OCI_SUCCESS {
+			freeColumns(oci8cols, fetchSize, indrlenptr)
 			return nil, ociGetError(rp.rv, s.c.err)
 		} else {
 			p = rp.ptr
 		}
 
 		if tpr := C.WrapOCIAttrGetUb2(p, C.OCI_DTYPE_PARAM, C.OCI_ATTR_DATA_TYPE, (*C.OCIError)(s.c.err)); tpr.rv != C.OCI_SUCCESS {
+			freeColumns(oci8cols, fetchSize, indrlenptr)
 			return nil, ociGetError(tpr.rv, s.c.err)
 		} else {
 			tp = tpr.num
 		}
 
 		if nsr := C.WrapOCIAttrGetString(p, C.OCI_DTYPE_PARAM, C.OCI_ATTR_NAME, (*C.OCIError)(s.c.err)); nsr.rv != C.OCI_SUCCESS {
+			freeColumns(oci8cols, fetchSize, indrlenptr)
 			return nil, ociGetError(nsr.rv, s.c.err)
 		} else {
 			oci8cols[i].name = string((*[1 << 30]byte)(unsafe.Pointer(nsr.ptr))[0:int(nsr.size)])
 		}
 
 		if lpr := C.WrapOCIAttrGetUb2(p, C.OCI_DTYPE_PARAM, C.OCI_ATTR_DATA_SIZE, (*C.OCIError)(s.c.err)); lpr.rv != C.OCI_SUCCESS {
+			freeColumns(oci8cols, fetchSize, indrlenptr)
 			return nil, ociGetError(lpr.rv, s.c.err)
 		} else {
 			lp = lpr.num
@@ -1206,113 +2141,93 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 			// lp *= 4 // utf8 enc
 			oci8cols[i].kind = C.SQLT_CHR  // tp
 			oci8cols[i].size = int(lp) * 4 // utf8 enc
-			oci8cols[i].pbuf = C.malloc(C.size_t(oci8cols[i].size) + 1)
 
 		case C.SQLT_BIN:
 			oci8cols[i].kind = C.SQLT_BIN
 			oci8cols[i].size = int(lp)
-			oci8cols[i].pbuf = C.malloc(C.size_t(oci8cols[i].size))
 
 		case C.SQLT_NUM:
 			oci8cols[i].kind = C.SQLT_CHR
 			oci8cols[i].size = int(lp * 4)
-			oci8cols[i].pbuf = C.malloc(C.size_t(oci8cols[i].size) + 1)
 
 		case C.SQLT_IBDOUBLE, C.SQLT_IBFLOAT:
 			oci8cols[i].kind = C.SQLT_IBDOUBLE
 			oci8cols[i].size = int(8)
-			oci8cols[i].pbuf = C.malloc(8)
 
 		case C.SQLT_LNG:
 			oci8cols[i].kind = C.SQLT_BIN
 			oci8cols[i].size = 2000
-			oci8cols[i].pbuf = C.malloc(C.size_t(oci8cols[i].size))
 
 		case C.SQLT_CLOB, C.SQLT_BLOB:
-			// allocate +io buffers + ub4
-			size := int(unsafe.Sizeof(unsafe.Pointer(nil)) + unsafe.Sizeof(C.ub4(0)))
-			if oci8cols[i].size < blobBufSize {
-				size += blobBufSize
-			} else {
-				size += oci8cols[i].size
-			}
-			if ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_LOB, C.size_t(size)); ret.rv != C.OCI_SUCCESS {
-				return nil, ociGetError(ret.rv, s.c.err)
-			} else {
-
-				oci8cols[i].kind = tp
-				oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
-				oci8cols[i].pbuf = ret.extra
-				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-
-			}
+			// one locator per row, read buffer shared by all rows: ub4 + io buffer
+			oci8cols[i].kind = tp
+			oci8cols[i].lobbuf = C.malloc(C.size_t(unsafe.Sizeof(C.ub4(0))) + blobBufSize)
 
 			//      testing
 			//		case C.SQLT_DAT:
 			//
 			//			oci8cols[i].kind = C.SQLT_DAT
 			//			oci8cols[i].size = int(lp)
-			//			oci8cols[i].pbuf = C.malloc(C.size_t(lp))
 			//
 
 		case C.SQLT_TIMESTAMP, C.SQLT_DAT:
-			if ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_TIMESTAMP, C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)))); ret.rv != C.OCI_SUCCESS {
-				return nil, ociGetError(ret.rv, s.c.err)
-			} else {
-
-				oci8cols[i].kind = C.SQLT_TIMESTAMP
-				oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
-				oci8cols[i].pbuf = ret.extra
-				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-			}
+			oci8cols[i].kind = C.SQLT_TIMESTAMP
 
 		case C.SQLT_TIMESTAMP_TZ, C.SQLT_TIMESTAMP_LTZ:
-			if ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_TIMESTAMP_TZ, C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)))); ret.rv != C.OCI_SUCCESS {
-				return nil, ociGetError(ret.rv, s.c.err)
-			} else {
-
-				oci8cols[i].kind = C.SQLT_TIMESTAMP_TZ
-				oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
-				oci8cols[i].pbuf = ret.extra
-				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-			}
+			oci8cols[i].kind = C.SQLT_TIMESTAMP_TZ
 
 		case C.SQLT_INTERVAL_DS:
-			if ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_INTERVAL_DS, C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)))); ret.rv != C.OCI_SUCCESS {
-				return nil, ociGetError(ret.rv, s.c.err)
-			} else {
-
-				oci8cols[i].kind = C.SQLT_INTERVAL_DS
-				oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
-				oci8cols[i].pbuf = ret.extra
-				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-			}
+			oci8cols[i].kind = C.SQLT_INTERVAL_DS
 
 		case C.SQLT_INTERVAL_YM:
-			if ret := C.WrapOCIDescriptorAlloc(s.c.env, C.OCI_DTYPE_INTERVAL_YM, C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)))); ret.rv != C.OCI_SUCCESS {
-				return nil, ociGetError(ret.rv, s.c.err)
-			} else {
-
-				oci8cols[i].kind = C.SQLT_INTERVAL_YM
-				oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
-				oci8cols[i].pbuf = ret.extra
-				*(*unsafe.Pointer)(ret.extra) = ret.ptr
-			}
+			oci8cols[i].kind = C.SQLT_INTERVAL_YM
 
 		case C.SQLT_RDD: // rowid
 			lp = 40
-			oci8cols[i].pbuf = C.malloc(C.size_t(lp) + 1)
 			oci8cols[i].kind = C.SQLT_CHR // tp
 			oci8cols[i].size = int(lp + 1)
 
 		default:
-			oci8cols[i].pbuf = C.malloc(C.size_t(lp) + 1)
 			oci8cols[i].kind = C.SQLT_CHR // tp
 			oci8cols[i].size = int(lp + 1)
 		}
 
-		oci8cols[i].ind = &indrlen[i].ind
-		oci8cols[i].rlen = &indrlen[i].rlen
+		if descriptorType(oci8cols[i].kind) != 0 {
+			oci8cols[i].size = int(unsafe.Sizeof(unsafe.Pointer(nil)))
+		}
+	}
+
+	// the fetch array takes at most maxFetchArrayBytes, unless a single row
+	// is larger
+	rowSize := 0
+	for i := range oci8cols {
+		rowSize += oci8cols[i].size + C.sizeof_indrlen
+	}
+	if rowSize > 0 && fetchSize > maxFetchArrayBytes/rowSize {
+		if fetchSize = maxFetchArrayBytes / rowSize; fetchSize < 1 {
+			fetchSize = 1
+		}
+	}
+
+	indrlenptr = C.calloc(C.size_t(rc*fetchSize), C.sizeof_indrlen)
+	for i := 0; i < rc; i++ {
+		if dtype := descriptorType(oci8cols[i].kind); dtype != 0 {
+			// array of descriptors, one per fetched row
+			oci8cols[i].pbuf = C.calloc(C.size_t(fetchSize), C.size_t(oci8cols[i].size))
+			for j := 0; j < fetchSize; j++ {
+				if ret := C.WrapOCIDescriptorAlloc(s.c.env, dtype, 0); ret.rv != C.OCI_SUCCESS {
+					freeColumns(oci8cols, fetchSize, indrlenptr)
+					return nil, ociGetError(ret.rv, s.c.err)
+				} else {
+					*(*unsafe.Pointer)(oci8cols[i].value(j)) = ret.ptr
+				}
+			}
+		} else {
+			oci8cols[i].pbuf = C.malloc(C.size_t(oci8cols[i].size*fetchSize) + 1)
+		}
+
+		p := unsafe.Pointer(uintptr(indrlenptr) + uintptr(i*fetchSize)*C.sizeof_indrlen)
+		oci8cols[i].indrlen = (*[maxFetchArraySize]C.indrlen)(p)[:fetchSize:fetchSize]
 
 		if rv := C.OCIDefineByPos(
 			(*C.OCIStmt)(s.s),
@@ -1322,13 +2237,26 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 			oci8cols[i].pbuf,
 			C.sb4(oci8cols[i].size),
 			oci8cols[i].kind,
-			unsafe.Pointer(oci8cols[i].ind),
-			oci8cols[i].rlen,
+			unsafe.Pointer(&oci8cols[i].indrlen[0].ind),
+			&oci8cols[i].indrlen[0].rlen,
 			nil,
 			C.OCI_DEFAULT); rv != C.OCI_SUCCESS {
-			C.free(indrlenptr)
+			freeColumns(oci8cols, fetchSize, indrlenptr)
 			return nil, ociGetError(rv, s.c.err)
 		}
+
+		if fetchSize > 1 {
+			if rv := C.OCIDefineArrayOfStruct(
+				*s.defp,
+				(*C.OCIError)(s.c.err),
+				C.ub4(oci8cols[i].size),
+				C.sizeof_indrlen,
+				C.sizeof_indrlen,
+				0); rv != C.OCI_SUCCESS {
+				freeColumns(oci8cols, fetchSize, indrlenptr)
+				return nil, ociGetError(rv, s.c.err)
+			}
+		}
 	}
 
 	rows := &OCI8Rows{
@@ -1336,22 +2264,11 @@ func (s *OCI8Stmt) query(ctx context.Context, args []namedValue) (driver.Rows, e
 		cols:       oci8cols,
 		e:          false,
 		indrlenptr: indrlenptr,
+		fetchSize:  fetchSize,
+		ctx:        ctx,
 		closed:     false,
-		done:       make(chan struct{}),
 		cls:        false,
 	}
-
-	go func() {
-		select {
-		case <-ctx.Done():
-			C.OCIBreak(
-				unsafe.Pointer(s.c.svc),
-				(*C.OCIError)(s.c.err))
-			rows.Close()
-		case <-rows.done:
-		}
-	}()
-
 	return rows, nil
 }
 
@@ -1383,6 +2300,47 @@ func (s *OCI8Stmt) rowsAffected() (int64, error) {
 	return int64(retUb4.num), nil
 }
 
+// rowCounts returns the number of rows affected by each iteration of the
+// last execution, which must have used OCI_RETURN_ROW_COUNT_ARRAY.
+func (s *OCI8Stmt) rowCounts() ([]int64, error) {
+	ret := C.WrapOCIAttrGetString(s.s, C.OCI_HTYPE_STMT, C.OCI_ATTR_DML_ROW_COUNT_ARRAY, (*C.OCIError)(s.c.err))
+	if ret.rv != C.OCI_SUCCESS {
+		return nil, ociGetError(ret.rv, s.c.err)
+	}
+	counts := make([]int64, int(ret.size))
+	if ret.size > 0 {
+		for i, n := range (*[1 << 26]C.ub8)(unsafe.Pointer(ret.ptr))[0:int(ret.size)] {
+			counts[i] = int64(n)
+		}
+	}
+	return counts, nil
+}
+
+// batchErrors collects the rows rejected by an execution in
+// OCI_BATCH_ERRORS mode. It returns nil when all rows succeeded.
+func (s *OCI8Stmt) batchErrors(counts []int64) error {
+	num := C.WrapOCIAttrGetUb4(s.s, C.OCI_HTYPE_STMT, C.OCI_ATTR_NUM_DML_ERRORS, (*C.OCIError)(s.c.err))
+	if num.rv != C.OCI_SUCCESS {
+		return ociGetError(num.rv, s.c.err)
+	}
+	if num.num == 0 {
+		return nil
+	}
+	be := &BatchError{RowCounts: counts}
+	for i := C.ub4(0); i < num.num; i++ {
+		ret := C.WrapOCIBatchErrorGet((*C.OCIEnv)(s.c.env), (*C.OCIError)(s.c.err), i)
+		if ret.rv != C.OCI_SUCCESS {
+			return ociGetError(ret.rv, s.c.err)
+		}
+		be.Errors = append(be.Errors, BatchRowError{
+			Offset:  int(ret.offset),
+			Code:    int(ret.code),
+			Message: strings.TrimSpace(C.GoString(&ret.err[0])),
+		})
+	}
+	return be
+}
+
 type OCI8Result struct {
 	n     int64
 	errn  error
@@ -1415,6 +2373,16 @@ func (s *OCI8Stmt) exec(ctx context.Context, args []namedValue) (r driver.Result
 		fbp []oci8bind
 	)
 
+	iters, array, err := arrayBindSize(args)
+	if err != nil {
+		return nil, err
+	}
+	if !array {
+		iters = 1
+	} else if iters == 0 {
+		return &OCI8Result{s: s}, nil
+	}
+
 	if fbp, err = s.bind(args); err != nil {
 		return nil, err
 	}
@@ -1426,29 +2394,55 @@ func (s *OCI8Stmt) exec(ctx context.Context, args []namedValue) (r driver.Result
 		mode = mode | C.OCI_COMMIT_ON_SUCCESS
 	}
 
-	done := make(chan struct{})
-	defer close(done)
-	go func() {
-		select {
-		case <-ctx.Done():
-			C.OCIBreak(
-				unsafe.Pointer(s.c.svc),
-				(*C.OCIError)(s.c.err))
-		case <-done:
-		}
-	}()
+	batchErrors, _ := ctx.Value(batchErrorsKey{}).(bool)
+	rowCounts, _ := ctx.Value(rowCountsKey{}).(*[]int64)
+	if batchErrors {
+		mode = mode | C.OCI_BATCH_ERRORS
+	}
+	if rowCounts != nil && ociMajorVersion < 12 {
+		return nil, clientVersionError("WithRowCounts", "12.1")
+	}
+	// batch errors get no row counts from older clients
+	countRows := (batchErrors || rowCounts != nil) && ociMajorVersion >= 12
+	if countRows {
+		mode = mode | C.OCI_RETURN_ROW_COUNT_ARRAY
+	}
 
+	cl, err := s.c.startCall(ctx)
+	if err != nil {
+		return nil, err
+	}
 	rv := C.OCIStmtExecute(
 		(*C.OCISvcCtx)(s.c.svc),
 		(*C.OCIStmt)(s.s),
 		(*C.OCIError)(s.c.err),
-		1,
+		C.ub4(iters),
 		0,
 		nil,
 		nil,
 		mode)
 	if rv != C.OCI_SUCCESS && rv != C.OCI_SUCCESS_WITH_INFO {
-		return nil, ociGetError(rv, s.c.err)
+		err = s.c.timeoutError(withSQL(ociGetError(rv, s.c.err), s.sql))
+	}
+	if err = cl.finish(err); err != nil {
+		return nil, err
+	}
+
+	if batchErrors || rowCounts != nil {
+		var counts []int64
+		if countRows {
+			if counts, err = s.rowCounts(); err != nil {
+				return nil, err
+			}
+		}
+		if rowCounts != nil {
+			*rowCounts = counts
+		}
+		if batchErrors {
+			if err = s.batchErrors(counts); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	n, en := s.rowsAffected()
@@ -1457,24 +2451,40 @@ func (s *OCI8Stmt) exec(ctx context.Context, args []namedValue) (r driver.Result
 	if n > 0 {
 		id, ei = s.lastInsertId()
 	}
-	outputBoundParameters(fbp)
+	if err = s.outputBoundParameters(ctx, fbp); err != nil {
+		return nil, err
+	}
 	return &OCI8Result{s: s, n: n, errn: en, id: id, errid: ei}, nil
 }
 
 type oci8col struct {
-	name string
-	kind C.ub2
-	size int
-	ind  *C.sb2
-	rlen *C.ub2
-	pbuf unsafe.Pointer
+	name    string
+	kind    C.ub2
+	size    int
+	indrlen []C.indrlen    // indicator and length, one per fetched row
+	pbuf    unsafe.Pointer // fetch array, size bytes per row
+	lobbuf  unsafe.Pointer // LOB read buffer
+}
+
+// value returns the address of the value for row in the fetch array.
+func (col *oci8col) value(row int) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(col.pbuf) + uintptr(row*col.size))
 }
 
 type oci8bind struct {
-	kind C.ub2
-	pbuf unsafe.Pointer
-	clen C.sb4
-	out  interface{} // original binded data type
+	kind   C.ub2
+	pbuf   unsafe.Pointer
+	clen   C.sb4
+	ind    *C.sb2      // indicator of output parameters
+	alen   *C.ub2      // actual lengths of array elements and outputs
+	n      int         // number of array elements, 0 for scalars
+	out    interface{} // original binded data type
+	cursor *OCI8Stmt   // statement bound to a REF CURSOR
+}
+
+// value returns the address of array element i.
+func (b *oci8bind) value(i int) unsafe.Pointer {
+	return unsafe.Pointer(uintptr(b.pbuf) + uintptr(i*int(b.clen)))
 }
 
 type OCI8Rows struct {
@@ -1482,9 +2492,134 @@ type OCI8Rows struct {
 	cols       []oci8col
 	e          bool
 	indrlenptr unsafe.Pointer
+	fetchSize  int // rows per OCIStmtFetch2
+	nrows      int // rows in current fetch array
+	cur        int // next row in fetch array
+	eof        bool
 	closed     bool
-	done       chan struct{}
 	cls        bool
+	ctx        context.Context // of the query, limits the time of fetches
+}
+
+type (
+	fetchArraySizeKey struct{}
+	batchErrorsKey    struct{}
+	rowCountsKey      struct{}
+)
+
+// maxFetchArraySize is the most rows fetched per round trip.
+const maxFetchArraySize = 65535
+
+// maxFetchArrayBytes is the most memory of the fetch array of rows, which
+// lowers the fetch array size of wide rows.
+const maxFetchArrayBytes = 16 << 20
+
+// fetchArraySize returns the number of rows to fetch per round trip for
+// queries run with ctx.
+func (c *OCI8Conn) fetchArraySize(ctx context.Context) int {
+	if n, ok := ctx.Value(fetchArraySizeKey{}).(int); ok && n > 0 {
+		if n > maxFetchArraySize {
+			return maxFetchArraySize
+		}
+		return n
+	}
+	return int(c.fetch_array_size)
+}
+
+// setCallTimeout sets OCI_ATTR_CALL_TIMEOUT for the next round trips to
+// the time left until the deadline of ctx, or to call_timeout when that is
+// less. Clients before release 18 have no call timeout, the deadline of ctx
+// breaks the call.
+func (c *OCI8Conn) setCallTimeout(ctx context.Context) error {
+	d := c.call_timeout
+	deadline := false
+	if t, ok := ctx.Deadline(); ok {
+		left := t.Sub(time.Now())
+		if left <= 0 {
+			return context.DeadlineExceeded
+		}
+		if d == 0 || left < d {
+			d, deadline = left, true
+		}
+	}
+	if ociMajorVersion < 18 {
+		return nil
+	}
+	ms := C.ub4(0)
+	if d > 0 {
+		if n := (d + time.Millisecond - 1) / time.Millisecond; n < math.MaxUint32 {
+			ms = C.ub4(n)
+		} else {
+			ms = math.MaxUint32
+		}
+	}
+	c.callDeadline = deadline
+	if ms == c.callTimeout {
+		return nil
+	}
+	if rv := C.WrapOCIAttrSetUb4(c.svc, C.OCI_HTYPE_SVCCTX, ms, C.OCI_ATTR_CALL_TIMEOUT, (*C.OCIError)(c.err)); rv != C.OCI_SUCCESS {
+		return ociGetError(rv, c.err)
+	}
+	c.callTimeout = ms
+	return nil
+}
+
+// timeoutError returns a *TimeoutError for err when it is ORA-03156, the
+// error of a call out of time.
+func (c *OCI8Conn) timeoutError(err error) error {
+	if oe, ok := err.(*OCI8Error); ok && oe.Code == 3156 {
+		return &TimeoutError{
+			Limit:    time.Duration(c.callTimeout) * time.Millisecond,
+			Err:      oe,
+			deadline: c.callDeadline,
+		}
+	}
+	return err
+}
+
+// WithFetchArraySize returns a copy of ctx which makes queries fetch n rows
+// per round trip, overriding the fetch_array_size DSN parameter. n is at
+// most 65535, and lowered for the fetch array of wide rows to stay within
+// 16 MiB.
+func WithFetchArraySize(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchArraySizeKey{}, n)
+}
+
+// WithBatchErrors returns a copy of ctx which makes array DML continue past
+// failing rows. The rows which failed are reported in a *BatchError, the
+// others are executed.
+func WithBatchErrors(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchErrorsKey{}, true)
+}
+
+// WithRowCounts returns a copy of ctx which makes exec store the number of
+// rows affected by each element of array arguments in counts. It needs an
+// Oracle client of release 12.1 or later.
+func WithRowCounts(ctx context.Context, counts *[]int64) context.Context {
+	return context.WithValue(ctx, rowCountsKey{}, counts)
+}
+
+// BatchRowError is the error for one row of array DML run with
+// WithBatchErrors.
+type BatchRowError struct {
+	Offset  int // index of the row in the array arguments
+	Code    int // ORA error code
+	Message string
+}
+
+func (e BatchRowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Offset, e.Message)
+}
+
+// BatchError is returned by array DML run with WithBatchErrors when some of
+// the rows failed.
+type BatchError struct {
+	Errors    []BatchRowError
+	RowCounts []int64 // rows affected by each iteration, nil before client release 12.1
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("oci8: %d rows failed in batch, first %s", len(e.Errors), e.Errors[0].Error())
 }
 
 func freeDecriptor(p unsafe.Pointer, dtype C.ub4) {
@@ -1492,39 +2627,84 @@ func freeDecriptor(p unsafe.Pointer, dtype C.ub4) {
 	C.OCIDescriptorFree(unsafe.Pointer(tptr), dtype)
 }
 
+// descriptorType returns the descriptor type used to define columns of
+// kind, or 0 if kind is fetched into a plain buffer.
+func descriptorType(kind C.ub2) C.ub4 {
+	switch kind {
+	case C.SQLT_CLOB, C.SQLT_BLOB:
+		return C.OCI_DTYPE_LOB
+	case C.SQLT_TIMESTAMP:
+		return C.OCI_DTYPE_TIMESTAMP
+	case C.SQLT_TIMESTAMP_TZ:
+		return C.OCI_DTYPE_TIMESTAMP_TZ
+	case C.SQLT_INTERVAL_DS:
+		return C.OCI_DTYPE_INTERVAL_DS
+	case C.SQLT_INTERVAL_YM:
+		return C.OCI_DTYPE_INTERVAL_YM
+	}
+	return 0
+}
+
+func freeColumns(cols []oci8col, fetchSize int, indrlenptr unsafe.Pointer) {
+	C.free(indrlenptr)
+	for i := range cols {
+		col := &cols[i]
+		if col.lobbuf != nil {
+			C.free(col.lobbuf)
+			col.lobbuf = nil
+		}
+		if col.pbuf == nil {
+			continue
+		}
+		if dtype := descriptorType(col.kind); dtype != 0 {
+			for j := 0; j < fetchSize; j++ {
+				if *(*unsafe.Pointer)(col.value(j)) != nil {
+					freeDecriptor(col.value(j), dtype)
+				}
+			}
+		}
+		C.free(col.pbuf)
+		col.pbuf = nil
+	}
+}
+
 func (rc *OCI8Rows) Close() error {
 	if rc.closed {
 		return nil
 	}
-	rc.closed = true
+	if rc.cls {
+		rc.s.c.calls.Lock()
+		defer rc.s.c.calls.Unlock()
+	}
+	return rc.close()
+}
 
-	close(rc.done)
+// close implements Close, with the calls of the connection held when the
+// rows close their statement.
+func (rc *OCI8Rows) close() error {
+	if rc.closed {
+		return nil
+	}
+	rc.closed = true
 
 	if rc.cls {
-		rc.s.Close()
+		delete(rc.s.c.cursors, rc)
+		rc.s.close()
 	}
 
-	C.free(rc.indrlenptr)
-	for _, col := range rc.cols {
-		switch col.kind {
-		case C.SQLT_CLOB, C.SQLT_BLOB:
-			freeDecriptor(col.pbuf, C.OCI_DTYPE_LOB)
-		case C.SQLT_TIMESTAMP:
-			freeDecriptor(col.pbuf, C.OCI_DTYPE_TIMESTAMP)
-		case C.SQLT_TIMESTAMP_TZ:
-			freeDecriptor(col.pbuf, C.OCI_DTYPE_TIMESTAMP_TZ)
-		case C.SQLT_INTERVAL_DS:
-			freeDecriptor(col.pbuf, C.OCI_DTYPE_INTERVAL_DS)
-		case C.SQLT_INTERVAL_YM:
-			freeDecriptor(col.pbuf, C.OCI_DTYPE_INTERVAL_YM)
-		default:
-			C.free(col.pbuf)
-		}
-		col.pbuf = nil
-	}
+	freeColumns(rc.cols, rc.fetchSize, rc.indrlenptr)
 	return nil
 }
 
+// closeCursors closes the REF CURSOR rows not closed yet, before the session
+// ends or goes back to the pool. The statements left open go with the
+// session. The calls of c are held.
+func (c *OCI8Conn) closeCursors() {
+	for rc := range c.cursors {
+		rc.close()
+	}
+}
+
 func (rc *OCI8Rows) Columns() []string {
 	cols := make([]string, len(rc.cols))
 	for i, col := range rc.cols {
@@ -1533,37 +2713,111 @@ func (rc *OCI8Rows) Columns() []string {
 	return cols
 }
 
-func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
-	if rc.closed {
-		return nil
+// fetch refills the fetch array of rc by OCIStmtFetch2, in a call of the
+// context of the query. It returns io.EOF when no row is left.
+func (rc *OCI8Rows) fetch() (err error) {
+	cl, err := rc.s.c.startCall(rc.ctx)
+	if err != nil {
+		return err
 	}
+	defer func() { err = cl.finish(err) }()
 
 	rv := C.OCIStmtFetch2(
 		(*C.OCIStmt)(rc.s.s),
 		(*C.OCIError)(rc.s.c.err),
-		1,
+		C.ub4(rc.fetchSize),
 		C.OCI_FETCH_NEXT,
 		0,
 		C.OCI_DEFAULT)
 
 	if rv == C.OCI_NO_DATA {
-		return io.EOF
+		// last, partially filled fetch array
+		rc.eof = true
 	} else if rv != C.OCI_SUCCESS && rv != C.OCI_SUCCESS_WITH_INFO {
-		return ociGetError(rv, rc.s.c.err)
+		return rc.s.c.timeoutError(withSQL(ociGetError(rv, rc.s.c.err), rc.s.sql))
+	}
+
+	retUb4 := C.WrapOCIAttrGetUb4(rc.s.s, C.OCI_HTYPE_STMT, C.OCI_ATTR_ROWS_FETCHED, (*C.OCIError)(rc.s.c.err))
+	if retUb4.rv != C.OCI_SUCCESS {
+		return ociGetError(retUb4.rv, rc.s.c.err)
+	}
+	if retUb4.num == 0 {
+		rc.eof = true
+		return io.EOF
+	}
+	rc.nrows = int(retUb4.num)
+	rc.cur = 0
+	return nil
+}
+
+// readLob reads the whole LOB of the locator buffer pbuf of col, in a call
+// of the context of the query.
+func (rc *OCI8Rows) readLob(col *oci8col, pbuf unsafe.Pointer) (_ []byte, err error) {
+	cl, err := rc.s.c.startCall(rc.ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = cl.finish(err) }()
+
+	bamt := (*C.ub4)(col.lobbuf)
+	ptmp := unsafe.Pointer(uintptr(col.lobbuf) + unsafe.Sizeof(C.ub4(0)))
+	b := (*[1 << 30]byte)(ptmp)[0:blobBufSize]
+	var buf []byte
+again:
+	*bamt = 0
+	rv := C.OCILobRead(
+		(*C.OCISvcCtx)(rc.s.c.svc),
+		(*C.OCIError)(rc.s.c.err),
+		*(**C.OCILobLocator)(pbuf),
+		bamt,
+		1,
+		ptmp,
+		C.ub4(blobBufSize),
+		nil,
+		nil,
+		0,
+		C.SQLCS_IMPLICIT)
+	if rv == C.OCI_NEED_DATA {
+		buf = append(buf, b[:int(*bamt)]...)
+		goto again
+	}
+	if rv != C.OCI_SUCCESS {
+		return nil, rc.s.c.timeoutError(ociGetError(rv, rc.s.c.err))
+	}
+	return append(buf, b[:int(*bamt)]...), nil
+}
+
+func (rc *OCI8Rows) Next(dest []driver.Value) error {
+	if rc.closed {
+		return nil
+	}
+
+	if rc.cur >= rc.nrows {
+		if rc.eof {
+			return io.EOF
+		}
+		if err := rc.fetch(); err != nil {
+			return err
+		}
 	}
+	row := rc.cur
+	rc.cur++
 
 	for i := range dest {
-		// TODO: switch rc.cols[i].ind
-		if *rc.cols[i].ind == -1 { // Null
+		ind := rc.cols[i].indrlen[row].ind
+		rlen := rc.cols[i].indrlen[row].rlen
+		pbuf := rc.cols[i].value(row)
+		// TODO: switch ind
+		if ind == -1 { // Null
 			dest[i] = nil
 			continue
-		} else if *rc.cols[i].ind != 0 {
-			return errors.New(fmt.Sprintf("Unknown column indicator: %d, col %s", rc.cols[i].ind, rc.cols[i].name))
+		} else if ind != 0 {
+			return errors.New(fmt.Sprintf("Unknown column indicator: %d, col %s", ind, rc.cols[i].name))
 		}
 
 		switch rc.cols[i].kind {
 		case C.SQLT_DAT: // for test, date are return as timestamp
-			buf := (*[1 << 30]byte)(rc.cols[i].pbuf)[0:*rc.cols[i].rlen]
+			buf := (*[1 << 30]byte)(pbuf)[0:rlen]
 			// TODO: Handle BCE dates (http://docs.oracle.com/cd/B12037_01/appdev.101/b10779/oci03typ.htm#438305)
 			// TODO: Handle timezones (http://docs.oracle.com/cd/B12037_01/appdev.101/b10779/oci03typ.htm#443601)
 			dest[i] = time.Date(
@@ -1576,66 +2830,44 @@ func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
 				0,
 				rc.s.c.location)
 		case C.SQLT_BLOB, C.SQLT_CLOB:
-			ptmp := unsafe.Pointer(uintptr(rc.cols[i].pbuf) + unsafe.Sizeof(unsafe.Pointer(nil)))
-			bamt := (*C.ub4)(ptmp)
-			ptmp = unsafe.Pointer(uintptr(rc.cols[i].pbuf) + unsafe.Sizeof(C.ub4(0)) + unsafe.Sizeof(unsafe.Pointer(nil)))
-			b := (*[1 << 30]byte)(ptmp)[0:blobBufSize]
-			var buf []byte
-		again:
-			*bamt = 0
-			rv = C.OCILobRead(
-				(*C.OCISvcCtx)(rc.s.c.svc),
-				(*C.OCIError)(rc.s.c.err),
-				*(**C.OCILobLocator)(rc.cols[i].pbuf),
-				bamt,
-				1,
-				ptmp,
-				C.ub4(blobBufSize),
-				nil,
-				nil,
-				0,
-				C.SQLCS_IMPLICIT)
-			if rv == C.OCI_NEED_DATA {
-				buf = append(buf, b[:int(*bamt)]...)
-				goto again
-			}
-			if rv != C.OCI_SUCCESS {
-				return ociGetError(rv, rc.s.c.err)
+			buf, err := rc.readLob(&rc.cols[i], pbuf)
+			if err != nil {
+				return err
 			}
 			if rc.cols[i].kind == C.SQLT_BLOB {
-				dest[i] = append(buf, b[:int(*bamt)]...)
+				dest[i] = buf
 			} else {
-				dest[i] = string(append(buf, b[:int(*bamt)]...))
+				dest[i] = string(buf)
 			}
 		case C.SQLT_CHR, C.SQLT_AFC, C.SQLT_AVC:
-			buf := (*[1 << 30]byte)(unsafe.Pointer(rc.cols[i].pbuf))[0:*rc.cols[i].rlen]
+			buf := (*[1 << 30]byte)(unsafe.Pointer(pbuf))[0:rlen]
 			switch {
-			case *rc.cols[i].ind == 0: // Normal
+			case ind == 0: // Normal
 				dest[i] = string(buf)
-			case *rc.cols[i].ind == -2 || // Field longer than type (truncated)
-				*rc.cols[i].ind > 0: // Field longer than type (truncated). Value is original length.
+			case ind == -2 || // Field longer than type (truncated)
+				ind > 0: // Field longer than type (truncated). Value is original length.
 				dest[i] = string(buf)
 			default:
-				return errors.New(fmt.Sprintf("Unknown column indicator: %d", rc.cols[i].ind))
+				return errors.New(fmt.Sprintf("Unknown column indicator: %d", ind))
 			}
 		case C.SQLT_BIN: // RAW
-			buf := (*[1 << 30]byte)(unsafe.Pointer(rc.cols[i].pbuf))[0:*rc.cols[i].rlen]
+			buf := (*[1 << 30]byte)(unsafe.Pointer(pbuf))[0:rlen]
 			dest[i] = buf
 		case C.SQLT_NUM: // NUMBER
-			buf := (*[21]byte)(unsafe.Pointer(rc.cols[i].pbuf))
+			buf := (*[21]byte)(unsafe.Pointer(pbuf))
 			dest[i] = buf
 		case C.SQLT_VNU: // VARNUM
-			buf := (*[22]byte)(unsafe.Pointer(rc.cols[i].pbuf))
+			buf := (*[22]byte)(unsafe.Pointer(pbuf))
 			dest[i] = buf
 		case C.SQLT_INT: // INT
-			buf := (*[1 << 30]byte)(unsafe.Pointer(rc.cols[i].pbuf))[0:*rc.cols[i].rlen]
+			buf := (*[1 << 30]byte)(unsafe.Pointer(pbuf))[0:rlen]
 			dest[i] = buf
 		case C.SQLT_LNG: // LONG
-			buf := (*[1 << 30]byte)(unsafe.Pointer(rc.cols[i].pbuf))[0:*rc.cols[i].rlen]
+			buf := (*[1 << 30]byte)(unsafe.Pointer(pbuf))[0:rlen]
 			dest[i] = buf
 		case C.SQLT_IBDOUBLE, C.SQLT_IBFLOAT:
 			colsize := rc.cols[i].size
-			buf := (*[1 << 30]byte)(unsafe.Pointer(rc.cols[i].pbuf))[0:colsize]
+			buf := (*[1 << 30]byte)(unsafe.Pointer(pbuf))[0:colsize]
 			if colsize == 4 {
 				v := uint32(buf[3])
 				v |= uint32(buf[2]) << 8
@@ -1674,7 +2906,7 @@ func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
 			if rv := C.WrapOCIDateTimeGetDateTime(
 				(*C.OCIEnv)(rc.s.c.env),
 				(*C.OCIError)(rc.s.c.err),
-				*(**C.OCIDateTime)(rc.cols[i].pbuf),
+				*(**C.OCIDateTime)(pbuf),
 			); rv.rv != C.OCI_SUCCESS {
 				return ociGetError(rv.rv, rc.s.c.err)
 			} else {
@@ -1689,38 +2921,13 @@ func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
 					rc.s.c.location)
 			}
 		case C.SQLT_TIMESTAMP_TZ, C.SQLT_TIMESTAMP_LTZ:
-			tptr := *(**C.OCIDateTime)(rc.cols[i].pbuf)
-			rv := C.WrapOCIDateTimeGetDateTime(
-				(*C.OCIEnv)(rc.s.c.env),
-				(*C.OCIError)(rc.s.c.err),
-				tptr)
-			if rv.rv != C.OCI_SUCCESS {
-				return ociGetError(rv.rv, rc.s.c.err)
-			}
-			rvz := C.WrapOCIDateTimeGetTimeZoneNameOffset(
-				(*C.OCIEnv)(rc.s.c.env),
-				(*C.OCIError)(rc.s.c.err),
-				tptr)
-			if rvz.rv != C.OCI_SUCCESS {
-				return ociGetError(rvz.rv, rc.s.c.err)
-			}
-			nnn := C.GoStringN((*C.char)((unsafe.Pointer)(&rvz.zone[0])), C.int(rvz.zlen))
-			loc, err := time.LoadLocation(nnn)
+			t, err := rc.s.c.ociTime(*(**C.OCIDateTime)(pbuf))
 			if err != nil {
-				// TODO: reuse locations
-				loc = time.FixedZone(nnn, int(rvz.h)*60*60+int(rvz.m)*60)
+				return err
 			}
-			dest[i] = time.Date(
-				int(rv.y),
-				time.Month(rv.m),
-				int(rv.d),
-				int(rv.hh),
-				int(rv.mm),
-				int(rv.ss),
-				int(rv.ff),
-				loc)
+			dest[i] = t
 		case C.SQLT_INTERVAL_DS:
-			iptr := *(**C.OCIInterval)(rc.cols[i].pbuf)
+			iptr := *(**C.OCIInterval)(pbuf)
 			rv := C.WrapOCIIntervalGetDaySecond(
 				(*C.OCIEnv)(rc.s.c.env),
 				(*C.OCIError)(rc.s.c.err),
@@ -1730,7 +2937,7 @@ func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
 			}
 			dest[i] = int64(time.Duration(rv.d)*time.Hour*24 + time.Duration(rv.hh)*time.Hour + time.Duration(rv.mm)*time.Minute + time.Duration(rv.ss)*time.Second + time.Duration(rv.ff))
 		case C.SQLT_INTERVAL_YM:
-			iptr := *(**C.OCIInterval)(rc.cols[i].pbuf)
+			iptr := *(**C.OCIInterval)(pbuf)
 			rv := C.WrapOCIIntervalGetYearMonth(
 				(*C.OCIEnv)(rc.s.c.env),
 				(*C.OCIError)(rc.s.c.err),
@@ -1747,22 +2954,45 @@ func (rc *OCI8Rows) Next(dest []driver.Value) (err error) {
 	return nil
 }
 
+// maxErrorRecords limits the error records read from an error handle.
+const maxErrorRecords = 32
+
 func ociGetErrorS(err unsafe.Pointer) error {
-	rv := C.WrapOCIErrorGet((*C.OCIError)(err))
-	s := C.GoString(&rv.err[0])
-	if isBadConnection(s) {
+	oe := &OCI8Error{}
+	for rec := C.ub4(1); rec <= maxErrorRecords; rec++ {
+		rv := C.WrapOCIErrorGet((*C.OCIError)(err), rec)
+		if rv.rv != C.OCI_SUCCESS {
+			break
+		}
+		oe.Records = append(oe.Records, OCI8ErrorRecord{
+			Code:    int(rv.code),
+			Message: C.GoString(&rv.err[0]),
+		})
+	}
+	if len(oe.Records) > 0 {
+		oe.Code = oe.Records[0].Code
+		oe.Message = oe.Records[0].Message
+	}
+	if isBadConnection(oe.Code) {
 		return driver.ErrBadConn
 	}
-	return errors.New(s)
+	if rv := C.WrapOCIAttrGetUb2(err, C.OCI_HTYPE_ERROR, C.OCI_ATTR_PARSE_ERROR_OFFSET, (*C.OCIError)(err)); rv.rv == C.OCI_SUCCESS {
+		oe.Offset = int(rv.num)
+	}
+	return oe
 }
 
-func isBadConnection(error string) bool {
-	if len(error) <= 8 {
-		return false
+// withSQL attaches the statement text to err if it is an *OCI8Error.
+func withSQL(err error, query string) error {
+	if oe, ok := err.(*OCI8Error); ok {
+		oe.SQL = query
 	}
-	errorCode := error[0:9]
+	return err
+}
+
+func isBadConnection(code int) bool {
 	for _, badConnCode := range badConnCodes {
-		if badConnCode == errorCode {
+		if badConnCode == code {
 			return true
 		}
 	}
@@ -0,0 +1,109 @@
+// +build go1.10
+
+package oci8
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+)
+
+// Connector implement driver.Connector, to be used with sql.OpenDB. With
+// the DSN parameter pool_max, the connections get their sessions from an
+// OCI session pool of the Connector, created by the first Connect. When
+// the Credentials of the DSN return new ones, Connect creates a new pool
+// and the old one goes when its connections are closed. ChangePassword is
+// not supported with a session pool.
+type Connector struct {
+	dsn  DSN
+	mu   sync.Mutex
+	pool *sessionPool
+}
+
+// NewConnector returns a Connector for the DSN string dsn.
+func NewConnector(dsn string) (*Connector, error) {
+	d, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{dsn: *d}, nil
+}
+
+// NewDSNConnector returns a Connector for dsn, which is copied. Use NewDSN
+// and SetParam to build dsn without formatting a DSN string.
+func NewDSNConnector(dsn *DSN) *Connector {
+	return &Connector{dsn: *dsn}
+}
+
+// Connect implement driver.Connector. The context bounds the time to log on.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.dsn.pool_max == 0 {
+		return c.dsn.connect(ctx)
+	}
+	pool, err := c.sessionPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return logonContext(ctx, pool.get)
+}
+
+// sessionPool returns the session pool with a reference taken for a new
+// connection. It creates the pool on first use, and again when the
+// credentials changed. The credentials are got before taking c.mu, not to
+// hold up the other connects.
+func (c *Connector) sessionPool(ctx context.Context) (*sessionPool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	username, password, err := c.dsn.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pool == nil || username != c.pool.username || password != c.pool.password {
+		pool, err := newSessionPool(&c.dsn, username, password)
+		if err != nil {
+			return nil, err
+		}
+		if c.pool != nil {
+			c.pool.release()
+		}
+		c.pool = pool
+	}
+	c.pool.acquire()
+	return c.pool, nil
+}
+
+// Close implement io.Closer, releasing the session pool. The pool is
+// destroyed once the connections holding its sessions are closed. sql.DB
+// calls it on Close, since go1.17.
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pool == nil {
+		return nil
+	}
+	err := c.pool.release()
+	c.pool = nil
+	return err
+}
+
+// Driver implement driver.Connector.
+func (c *Connector) Driver() driver.Driver {
+	return &OCI8Driver{}
+}
+
+// ResetSession implement driver.SessionResetter. It rolls back a transaction
+// left open and clears the module, action and client info, and returns
+// driver.ErrBadConn when the session is gone. Set the DSN parameter
+// reset_packages to reset the state of PL/SQL packages too.
+func (c *OCI8Conn) ResetSession(ctx context.Context) error {
+	return c.resetSession(ctx)
+}
+
+// OpenConnector implement driver.DriverContext.
+func (d *OCI8Driver) OpenConnector(name string) (driver.Connector, error) {
+	return NewConnector(name)
+}
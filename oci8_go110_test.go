@@ -0,0 +1,324 @@
+// +build go1.10
+
+package oci8
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnector(t *testing.T) {
+	c := NewDSNConnector(testDSN(t))
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow("select 1 from dual").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("want %v but %v", 1, n)
+	}
+}
+
+func TestConnectorContext(t *testing.T) {
+	d := NewDSN()
+	d.Connect = "XE"
+	d.Username = "scott"
+	d.Password = "tiger"
+	if err := d.SetParam("prefetch_rows", "100"); err != nil {
+		t.Fatal(err)
+	}
+	if d.prefetch_rows != 100 {
+		t.Fatalf("want %v but %v", 100, d.prefetch_rows)
+	}
+	if err := d.SetParam("prefech_rows", "100"); err == nil {
+		t.Fatal("expected an error for unknown parameter")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewDSNConnector(d).Connect(ctx); err != context.Canceled {
+		t.Fatalf("want %v but %v", context.Canceled, err)
+	}
+}
+
+func TestConnectorSessionPool(t *testing.T) {
+	d := testDSN(t, "pool_max", "4", "pool_min", "1")
+	c := NewDSNConnector(d)
+	db := sql.OpenDB(c)
+	db.SetMaxIdleConns(0)
+
+	for i := 0; i < 10; i++ {
+		var n int
+		if err := db.QueryRow("select 1 from dual").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("want %v but %v", 1, n)
+		}
+	}
+	if c.pool == nil {
+		t.Fatal("want a session pool")
+	}
+	db.Close()
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.pool != nil {
+		t.Fatal("want the session pool destroyed")
+	}
+}
+
+func TestSessionPoolCredentials(t *testing.T) {
+	d := testDSN(t, "pool_max", "2")
+	// usernames are case insensitive, a changed one is new credentials
+	usernames := []string{strings.ToLower(d.Username), strings.ToUpper(d.Username)}
+	calls := 0
+	d.Credentials = func(ctx context.Context) (string, string, error) {
+		calls++
+		return usernames[(calls-1)%2], d.Password, nil
+	}
+	c := NewDSNConnector(d)
+	defer c.Close()
+
+	conn1, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool1 := c.pool
+	conn2, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	if c.pool == pool1 {
+		t.Fatal("want a new session pool for new credentials")
+	}
+
+	// the old pool goes with its last connection
+	if pool1.pool == nil {
+		t.Fatal("want the old pool kept for its connection")
+	}
+	if err = conn1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if pool1.pool != nil {
+		t.Fatal("want the old pool destroyed")
+	}
+}
+
+func TestSessionPoolParams(t *testing.T) {
+	d, err := ParseDSN("scott/tiger@XE?pool_min=2&pool_max=10&pool_increment=2&pool_timeout=60&pool_wait=NOWAIT&pool_stmt_cache_size=50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.pool_min != 2 || d.pool_max != 10 || d.pool_increment != 2 || d.pool_timeout != 60 || d.pool_stmt_cache_size != 50 {
+		t.Fatalf("unexpected pool parameters %#v", d)
+	}
+	if s := FormatDSN(d); s != "scott/tiger@XE?pool_increment=2&pool_max=10&pool_min=2&pool_stmt_cache_size=50&pool_timeout=60&pool_wait=NOWAIT" {
+		t.Fatalf("unexpected FormatDSN %s", s)
+	}
+	if _, err = ParseDSN("scott/tiger@XE?pool_wait=SOMETIMES"); err == nil {
+		t.Fatal("expected an error for pool_wait=SOMETIMES")
+	}
+
+	ctx := context.Background()
+	d, _ = ParseDSN("scott/tiger@XE?pool_min=5&pool_max=2")
+	if _, err = NewDSNConnector(d).Connect(ctx); err == nil {
+		t.Fatal("expected an error for pool_min greater than pool_max")
+	}
+	d, _ = ParseDSN("app[end]/tiger@XE?pool_max=2")
+	if _, err = NewDSNConnector(d).Connect(ctx); err == nil {
+		t.Fatal("expected an error for proxy authentication with a session pool")
+	}
+	d, _ = ParseDSN("scott/tiger@XE?pool_max=2")
+	d.ChangePassword = func(ctx context.Context, username, oldPassword string, code int) (string, error) {
+		return "", nil
+	}
+	if _, err = NewDSNConnector(d).Connect(ctx); err == nil {
+		t.Fatal("expected an error for ChangePassword with a session pool")
+	}
+}
+
+func TestSharedEnv(t *testing.T) {
+	c := NewDSNConnector(testDSN(t))
+	refs := func() int {
+		sharedEnv.Lock()
+		defer sharedEnv.Unlock()
+		return sharedEnv.refs
+	}
+
+	before := refs()
+	var conns []driver.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := c.Connect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	if n := refs(); n != before+3 {
+		t.Fatalf("want %v references but %v", before+3, n)
+	}
+	if conns[0].(*OCI8Conn).env != conns[2].(*OCI8Conn).env {
+		t.Fatal("want the environment shared")
+	}
+	if conns[0].(*OCI8Conn).err == conns[2].(*OCI8Conn).err {
+		t.Fatal("want an error handle per connection")
+	}
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := refs(); n != before {
+		t.Fatalf("want %v references but %v", before, n)
+	}
+}
+
+func TestStmtCache(t *testing.T) {
+	d := testDSN(t, "stmt_cache_size", "10")
+	conn, err := NewDSNConnector(d).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		stmt, err := conn.Prepare("select 1 from dual")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = stmt.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := conn.(*OCI8Conn).StmtCacheStats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Fatalf("want 2 hits and 1 miss but %+v", stats)
+	}
+
+	// a statement left open goes with the session, closing it later only
+	// frees its memory
+	stmt, err := conn.Prepare("select 1 from dual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = stmt.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResetSession(t *testing.T) {
+	d := testDSN(t, "reset_packages", "YES")
+	conn, err := NewDSNConnector(d).Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := conn.(*OCI8Conn)
+
+	if _, err = c.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.inTransaction {
+		t.Fatal("want the transaction rolled back")
+	}
+	if !c.isValid() {
+		t.Fatal("want a valid connection")
+	}
+
+	c.markBad(driver.ErrBadConn)
+	if c.isValid() {
+		t.Fatal("want an invalid connection")
+	}
+	if err = c.ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Fatalf("want %v but %v", driver.ErrBadConn, err)
+	}
+}
+
+func TestQueryCallTimeout(t *testing.T) {
+	if ociMajorVersion < 18 {
+		t.Skip("call timeouts need an Oracle client of release 18 or later")
+	}
+	d := testDSN(t, "call_timeout", "500ms")
+	db := sql.OpenDB(NewDSNConnector(d))
+	defer db.Close()
+
+	const slow = "select count(*) from all_objects, all_objects, all_objects"
+	var n int64
+	err := db.QueryRow(slow).Scan(&n)
+	if te, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("want a *TimeoutError but %v", err)
+	} else if te.Is(context.DeadlineExceeded) {
+		t.Fatal("unexpected deadline for call_timeout")
+	}
+
+	// on the driver connection, as database/sql reports the error of a done
+	// context in place of that of the driver
+	dc, err := d.connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	rows, err := dc.(*OCI8Conn).query(ctx, slow, nil)
+	if err == nil {
+		err = rows.Next(make([]driver.Value, 1))
+		rows.Close()
+	}
+	if te, ok := err.(*TimeoutError); !ok {
+		t.Fatalf("want a *TimeoutError but %v", err)
+	} else if !te.Is(context.DeadlineExceeded) {
+		t.Fatalf("want the deadline of the context but %v", err)
+	} else if te.Limit > 200*time.Millisecond {
+		t.Fatalf("want a limit of at most %v but %v", 200*time.Millisecond, te.Limit)
+	}
+
+	if err = db.PingContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelQuery(t *testing.T) {
+	db := DB()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(100*time.Millisecond, cancel)
+		var n int64
+		err = conn.QueryRowContext(ctx, "select count(*) from all_objects, all_objects, all_objects").Scan(&n)
+		if err != context.Canceled {
+			t.Fatalf("want %v but %v", context.Canceled, err)
+		}
+
+		if _, err = conn.ExecContext(ctx, "begin null; end;"); err != context.Canceled {
+			t.Fatalf("want %v but %v", context.Canceled, err)
+		}
+
+		var s string
+		if err = conn.QueryRowContext(context.Background(), "select 'ok' from dual").Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		if s != "ok" {
+			t.Fatalf("want %v but %v", "ok", s)
+		}
+	}
+}
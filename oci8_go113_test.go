@@ -0,0 +1,39 @@
+// +build go1.13
+
+package oci8
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestOCI8ErrorIs(t *testing.T) {
+	err := error(&OCI8Error{
+		Code:    1,
+		Message: "ORA-00001: unique constraint (SCOTT.PK_FOO) violated\n",
+		Records: []OCI8ErrorRecord{
+			{Code: 1, Message: "ORA-00001: unique constraint (SCOTT.PK_FOO) violated\n"},
+			{Code: 6512, Message: "ORA-06512: at line 1\n"},
+		},
+	})
+	if !errors.Is(err, &OCI8Error{Code: 1}) {
+		t.Errorf("TestOCI8ErrorIs: %v should match code %d", err, 1)
+	}
+	if !errors.Is(err, &OCI8Error{Code: 6512}) {
+		t.Errorf("TestOCI8ErrorIs: %v should match code %d", err, 6512)
+	}
+	if errors.Is(err, &OCI8Error{Code: 942}) {
+		t.Errorf("TestOCI8ErrorIs: %v should not match code %d", err, 942)
+	}
+	var oe *OCI8Error
+	if !errors.As(fmt.Errorf("insert: %w", err), &oe) || oe.Code != 1 {
+		t.Errorf("TestOCI8ErrorIs: errors.As failed for %v", err)
+	}
+	if s := (&OCI8Error{}).Error(); s != "oci8: OCI call failed without an error record" {
+		t.Errorf("TestOCI8ErrorIs: unexpected message %q", s)
+	}
+	if s := (&OCI8Error{Code: 1}).Error(); s != "ORA-00001" {
+		t.Errorf("TestOCI8ErrorIs: unexpected message %q", s)
+	}
+}
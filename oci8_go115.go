@@ -0,0 +1,10 @@
+// +build go1.15
+
+package oci8
+
+// IsValid implement driver.Validator. A connection is invalid once an
+// error told its session is gone, or when OCI knows the server is
+// disconnected.
+func (c *OCI8Conn) IsValid() bool {
+	return c.isValid()
+}
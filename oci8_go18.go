@@ -2,8 +2,16 @@
 
 package oci8
 
+/*
+#include <oci.h>
+*/
+import "C"
+
 import (
+	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"fmt"
 
 	"context"
 )
@@ -14,13 +22,7 @@ func (c *OCI8Conn) Ping(ctx context.Context) error {
 }
 
 func toNamedValue(nv driver.NamedValue) namedValue {
-	mv := namedValue(nv)
-	// FIXME
-	// This is my fault that I've add code using sql.Out until next release.
-	//if out, ok := mv.Value.(sql.Out); ok {
-	//	mv.Value = outValue{Dest: out.Dest, In: out.In}
-	//}
-	return mv
+	return namedValue(nv)
 }
 
 // QueryContext implement QueryerContext.
@@ -47,8 +49,36 @@ func (c *OCI8Conn) PrepareContext(ctx context.Context, query string) (driver.Stm
 }
 
 // BeginTx implement ConnBeginTx.
+// sql.LevelDefault uses the isolation of the DSN. Read-only transactions are
+// serializable in oracle, so ReadOnly can't be combined with read committed.
 func (c *OCI8Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	return c.begin(ctx)
+	mode, err := c.transactionModeOf(opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.begin(ctx, mode)
+}
+
+func (c *OCI8Conn) transactionModeOf(opts driver.TxOptions) (C.ub4, error) {
+	level := sql.IsolationLevel(opts.Isolation)
+	switch level {
+	case sql.LevelDefault:
+		if opts.ReadOnly {
+			return C.OCI_TRANS_READONLY, nil
+		}
+		return c.transactionMode, nil
+	case sql.LevelSerializable:
+		if opts.ReadOnly {
+			return C.OCI_TRANS_READONLY, nil
+		}
+		return C.OCI_TRANS_SERIALIZABLE, nil
+	case sql.LevelReadCommitted:
+		if opts.ReadOnly {
+			return 0, errors.New("oci8: read-only transactions can't be read committed")
+		}
+		return C.OCI_TRANS_READWRITE, nil
+	}
+	return 0, fmt.Errorf("oci8: unsupported isolation level %v", level)
 }
 
 // QueryContext implement QueryerContext.
@@ -68,15 +98,3 @@ func (s *OCI8Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (d
 	}
 	return s.exec(ctx, list)
 }
-
-/* FIXME
-This is my fault that I've add code using sql.Out until next release.
-func (c *OCI8Conn) CheckNamedValue(nv *driver.NamedValue) error {
-	switch nv.Value.(type) {
-	default:
-		return driver.ErrSkip
-	case sql.Out:
-		return nil
-	}
-}
-*/
@@ -5,6 +5,9 @@ package oci8
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
 	"sync"
 	"testing"
 	"time"
@@ -17,33 +20,6 @@ func TestNamedParam(t *testing.T) {
 	}
 }
 
-/* FIXME
-func TestOutputBind(t *testing.T) {
-	db := DB()
-
-	s1 := "-----------------------------"
-	s2 := 11
-	s3 := false
-	_, err := db.Exec(`begin  :a := 42; :b := 'ddddd' ; :c := 2; end;`,
-		sql.Named("a", sql.Out{Dest: &s2}),
-		sql.Named("b", sql.Out{Dest: &s1}),
-		sql.Named("c", sql.Out{Dest: &s3}))
-	if err != nil {
-		t.Fatal(err)
-	}
-	s1want := "ddddd                        "
-	if s1 != s1want {
-		t.Fatalf("want %q but %q", s1want, s1)
-	}
-	if s2 != 42 {
-		t.Fatalf("want %v but %v", 42, s2)
-	}
-	if !s3 {
-		t.Fatalf("want %v but %v", true, s3)
-	}
-}
-*/
-
 func TestTimeout(t *testing.T) {
 	db := DB()
 	for i := 0; i < 2000; i++ {
@@ -75,3 +51,97 @@ func TestTimeout(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestFetchArraySize(t *testing.T) {
+	db := DB()
+
+	for _, size := range []int{1, 7, 25, 100} {
+		ctx := WithFetchArraySize(context.Background(), size)
+		rows, err := db.QueryContext(ctx, "select level, to_char(level), sysdate + level from dual connect by level <= 25")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := int64(0)
+		for rows.Next() {
+			var (
+				i  int64
+				s  string
+				tm time.Time
+			)
+			if err = rows.Scan(&i, &s, &tm); err != nil {
+				rows.Close()
+				t.Fatal(err)
+			}
+			n++
+			if i != n || s != fmt.Sprint(n) {
+				rows.Close()
+				t.Fatalf("fetch array size %d: want %d but %d, %q", size, n, i, s)
+			}
+		}
+		if err = rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if n != 25 {
+			t.Fatalf("fetch array size %d: want %d rows but %d", size, 25, n)
+		}
+	}
+
+	// the fetch array of wide rows is lowered to its byte budget
+	dc, err := testDSN(t).connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	ctx := WithFetchArraySize(context.Background(), maxFetchArraySize)
+	rows, err := dc.(*OCI8Conn).query(ctx, "select rpad('x', 4000, 'x') from dual connect by level <= 3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	rc := rows.(*OCI8Rows)
+	if rc.fetchSize*rc.cols[0].size > maxFetchArrayBytes {
+		t.Fatalf("want at most %d bytes but %d rows of %d", maxFetchArrayBytes, rc.fetchSize, rc.cols[0].size)
+	}
+	n := 0
+	for err = rows.Next(make([]driver.Value, 1)); err == nil; err = rows.Next(make([]driver.Value, 1)) {
+		n++
+	}
+	if err != io.EOF || n != 3 {
+		t.Fatalf("want %d rows but %d, %v", 3, n, err)
+	}
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	db := DB()
+	ctx := context.Background()
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("insert into foo(c1) values(:1)", "readonly"); err == nil {
+		t.Fatal("expected an error inserting in a read-only transaction")
+	}
+	tx.Rollback()
+
+	for _, level := range []sql.IsolationLevel{sql.LevelDefault, sql.LevelReadCommitted, sql.LevelSerializable} {
+		tx, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: level})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tx.Exec("insert into foo(c1) values(:1)", "isolation"); err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead}); err == nil {
+		t.Fatal("expected an error for unsupported isolation level")
+	}
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true}); err == nil {
+		t.Fatal("expected an error for read-only read committed")
+	}
+}
@@ -0,0 +1,26 @@
+// +build go1.9
+
+package oci8
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+// CheckNamedValue implement NamedValueChecker.
+// Slices other than byte slices are passed to the statement as is, to be bound
+// as arrays. sql.Out is bound as an output parameter, see OutString for
+// the size of string outputs. A *driver.Rows destination receives the rows
+// of a REF CURSOR output parameter. The rows are fetched on the connection
+// of the statement and closed with it, so read them inside a sql.Conn or
+// sql.Tx, which keep the connection out of the pool until they are done.
+func (c *OCI8Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if _, ok := arrayLen(nv.Value); ok {
+		return nil
+	}
+	if out, ok := nv.Value.(sql.Out); ok {
+		nv.Value = outValue{Dest: out.Dest, In: out.In}
+		return nil
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,262 @@
+// +build go1.9
+
+package oci8
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArrayBind(t *testing.T) {
+	db := DB()
+
+	c1 := []string{"one", "two", "three"}
+	c3 := []int64{1, 2, 3}
+	c8 := []float64{1.5, 2.5, 3.5}
+	c9 := []time.Time{time.Now(), time.Now().Add(time.Hour), time.Now().Add(2 * time.Hour)}
+
+	r, err := db.Exec("insert into foo(c1, c3, c8, c9) values(:1, :2, :3, :4)", c1, c3, c8, c9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.RowsAffected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("want %d but %d", 3, n)
+	}
+
+	rows, err := db.Query("select c1, c3, c8 from foo where c3 in (1, 2, 3) and c1 is not null order by c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	i := 0
+	for rows.Next() {
+		var (
+			s string
+			d int64
+			f float64
+		)
+		if err = rows.Scan(&s, &d, &f); err != nil {
+			t.Fatal(err)
+		}
+		if s != c1[i] || d != c3[i] || f != c8[i] {
+			t.Fatalf("want %v %v %v but %v %v %v", c1[i], c3[i], c8[i], s, d, f)
+		}
+		i++
+	}
+	if i != 3 {
+		t.Fatalf("want %d rows but %d", 3, i)
+	}
+
+	if _, err = db.Exec("insert into foo(c1, c3) values(:1, :2)", []string{"a"}, []int64{1, 2}); err == nil {
+		t.Fatal("arrays of different length should fail")
+	}
+	if _, err = db.Exec("insert into foo(c1, c3) values(:1, :2)", []string{"a"}, int64(1)); err == nil {
+		t.Fatal("mixed array and scalar arguments should fail")
+	}
+}
+
+func TestBatchErrors(t *testing.T) {
+	db := DB()
+
+	c1 := []string{"ok", strings.Repeat("x", 300), "ok"}
+	c3 := []int64{11, 12, 13}
+
+	var counts []int64
+	ctx := WithRowCounts(WithBatchErrors(context.Background()), &counts)
+	_, err := db.ExecContext(ctx, "insert into foo(c1, c3) values(:1, :2)", c1, c3)
+	be, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("want *BatchError but %v", err)
+	}
+	if len(be.Errors) != 1 || be.Errors[0].Offset != 1 || be.Errors[0].Code != 12899 {
+		t.Fatalf("unexpected batch errors: %+v", be.Errors)
+	}
+	if len(be.RowCounts) != 3 || be.RowCounts[0] != 1 || be.RowCounts[1] != 0 || be.RowCounts[2] != 1 {
+		t.Fatalf("unexpected row counts: %v", be.RowCounts)
+	}
+
+	_, err = db.ExecContext(ctx, "insert into foo(c1, c3) values(:1, :2)", []string{"a", "b"}, []int64{14, 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(counts) != 2 || counts[0] != 1 || counts[1] != 1 {
+		t.Fatalf("unexpected row counts: %v", counts)
+	}
+}
+
+func TestRefCursor(t *testing.T) {
+	// the rows are fetched on the connection of the statement
+	conn, err := DB().Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var rows driver.Rows
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	_, err = conn.ExecContext(ctx, `begin open :1 for select level, 'row ' || level from dual connect by level <= 3; end;`, sql.Out{Dest: &rows})
+	// fetches are not limited by the context of the statement
+	cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	if cols := rows.Columns(); len(cols) != 2 {
+		t.Fatalf("want %d columns but %v", 2, cols)
+	}
+	dest := make([]driver.Value, 2)
+	n := 0
+	for {
+		if err = rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if s := dest[1].(string); s != fmt.Sprintf("row %d", n) {
+			t.Fatalf("want %q but %q", fmt.Sprintf("row %d", n), s)
+		}
+	}
+	if n != 3 {
+		t.Fatalf("want %d rows but %d", 3, n)
+	}
+
+	// the rows are closed with the connection
+	dc, err := testDSN(t).connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := dc.(*OCI8Conn)
+	_, err = c.ExecContext(context.Background(), `begin open :1 for select 1 from dual; end;`,
+		[]driver.NamedValue{{Ordinal: 1, Value: outValue{Dest: &rows}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !rows.(*OCI8Rows).closed {
+		t.Fatal("want the rows closed with the connection")
+	}
+}
+
+func TestOutputBind(t *testing.T) {
+	db := DB()
+
+	s1 := "-----------------------------"
+	s2 := 11
+	s3 := false
+	_, err := db.Exec(`begin  :a := 42; :b := 'ddddd' ; :c := 2; end;`,
+		sql.Named("a", sql.Out{Dest: &s2}),
+		sql.Named("b", sql.Out{Dest: &s1}),
+		sql.Named("c", sql.Out{Dest: &s3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s1 != "ddddd" {
+		t.Fatalf("want %q but %q", "ddddd", s1)
+	}
+	if s2 != 42 {
+		t.Fatalf("want %v but %v", 42, s2)
+	}
+	if !s3 {
+		t.Fatalf("want %v but %v", true, s3)
+	}
+}
+
+func TestInOutBind(t *testing.T) {
+	db := DB()
+
+	var (
+		s  = "abc"
+		i8 = int8(3)
+		u  = uint32(4)
+		f  = 1.5
+		b  = []byte{1, 2}
+		tm = time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	_, err := db.Exec(`begin :1 := :1 || 'def'; :2 := :2 * 2; :3 := :3 * 2; :4 := :4 * 2; :5 := utl_raw.concat(:5, hextoraw('03')); :6 := :6 + 1; end;`,
+		sql.Out{Dest: &OutString{Value: &s, Size: 10}, In: true},
+		sql.Out{Dest: &i8, In: true},
+		sql.Out{Dest: &u, In: true},
+		sql.Out{Dest: &f, In: true},
+		sql.Out{Dest: &b, In: true},
+		sql.Out{Dest: &tm, In: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "abcdef" {
+		t.Fatalf("want %q but %q", "abcdef", s)
+	}
+	if i8 != 6 || u != 8 || f != 3 {
+		t.Fatalf("want 6, 8, 3 but %v, %v, %v", i8, u, f)
+	}
+	if string(b) != "\x01\x02\x03" {
+		t.Fatalf("want %v but %v", []byte{1, 2, 3}, b)
+	}
+	if want := time.Date(2017, 1, 3, 3, 4, 5, 0, time.UTC); !tm.Equal(want) {
+		t.Fatalf("want %v but %v", want, tm)
+	}
+
+	// a string output larger than its buffer fails
+	s = ""
+	_, err = db.Exec(`begin :1 := 'too long'; end;`, sql.Out{Dest: &OutString{Value: &s, Size: 3}})
+	if err == nil {
+		t.Fatal("expected an error for too small output buffer")
+	}
+
+	// unsigned values out of the range of the NUMBER binding fail
+	big := uint64(math.MaxUint64)
+	if _, err = db.Exec(`begin :1 := :1; end;`, sql.Out{Dest: &big, In: true}); err == nil {
+		t.Fatal("expected an error for unsigned value greater than MaxInt64")
+	}
+	u = 1
+	if _, err = db.Exec(`begin :1 := -1; end;`, sql.Out{Dest: &u}); err == nil {
+		t.Fatal("expected an error for negative unsigned output")
+	}
+}
+
+func TestOutputBindNull(t *testing.T) {
+	db := DB()
+
+	s := "x"
+	i := 1
+	ns := sql.NullString{String: "x", Valid: true}
+	ni := sql.NullInt64{Int64: 1, Valid: true}
+	_, err := db.Exec(`begin :1 := null; :2 := null; :3 := null; :4 := null; end;`,
+		sql.Out{Dest: &s},
+		sql.Out{Dest: &i},
+		sql.Out{Dest: &ns},
+		sql.Out{Dest: &ni})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "" || i != 0 {
+		t.Fatalf("want zero values but %q, %v", s, i)
+	}
+	if ns.Valid || ni.Valid {
+		t.Fatalf("want NULL but %v, %v", ns, ni)
+	}
+
+	// pure OUT parameters are bound as NULL
+	ni = sql.NullInt64{Int64: 5, Valid: true}
+	_, err = db.Exec(`begin :1 := nvl(:1, -1); end;`, sql.Out{Dest: &ni})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ni.Int64 != -1 {
+		t.Fatalf("want %v but %v", -1, ni.Int64)
+	}
+}
@@ -0,0 +1,445 @@
+package oci8
+
+/*
+#include <oci.h>
+
+// privileges of release 12.1 clients, rejected by the 'as' parameter with
+// older ones
+#if OCI_MAJOR_VERSION < 12
+#define OCI_SYSBKP 0x00020000
+#define OCI_SYSDGD 0x00040000
+#define OCI_SYSKMT 0x00080000
+#endif
+*/
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dsnParam is a parameter of the DSN query string.
+type dsnParam struct {
+	name string
+	set  func(dsn *DSN, v string) error
+	get  func(dsn *DSN) string // empty when at the default
+}
+
+// dsnParams are the parameters of the DSN query string, documented here
+// and nowhere else. New parameters plug in by adding a dsnParam, with its
+// doc comment.
+var dsnParams = []dsnParam{
+	// loc sets the timezone to read times in as and to marshal to when writing
+	// times to Oracle date.
+	{
+		name: "loc",
+		set: func(dsn *DSN, v string) (err error) {
+			if dsn.Location, err = time.LoadLocation(v); err != nil {
+				return fmt.Errorf("Invalid loc: %v: %v", v, err)
+			}
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			if dsn.Location == nil || dsn.Location == time.Local {
+				return ""
+			}
+			return dsn.Location.String()
+		},
+	},
+	// isolation =READONLY,SERIALIZABLE,DEFAULT, overridden by TxOptions of
+	// BeginTx.
+	{
+		name: "isolation",
+		set: func(dsn *DSN, v string) error {
+			switch v {
+			case "READONLY":
+				dsn.transactionMode = C.OCI_TRANS_READONLY
+			case "SERIALIZABLE":
+				dsn.transactionMode = C.OCI_TRANS_SERIALIZABLE
+			case "DEFAULT":
+				dsn.transactionMode = C.OCI_TRANS_READWRITE
+			default:
+				return fmt.Errorf("Invalid isolation: %v", v)
+			}
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			switch dsn.transactionMode {
+			case C.OCI_TRANS_READONLY:
+				return "READONLY"
+			case C.OCI_TRANS_SERIALIZABLE:
+				return "SERIALIZABLE"
+			}
+			return ""
+		},
+	},
+	// as =sysdba,sysoper,sysbackup,sysdg,syskm,sysasm logs on with the
+	// administrative privilege.
+	{
+		name: "as",
+		set: func(dsn *DSN, v string) error {
+			for mode, name := range privileges {
+				if strings.EqualFold(v, name) {
+					if ociMajorVersion < 12 && mode != C.OCI_SYSDBA && mode != C.OCI_SYSOPER && mode != C.OCI_SYSASM {
+						return clientVersionError("as="+name, "12.1")
+					}
+					dsn.privilege = mode
+					return nil
+				}
+			}
+			return fmt.Errorf("Invalid as: %v", v)
+		},
+		get: func(dsn *DSN) string {
+			return privileges[dsn.privilege]
+		},
+	},
+	// proxy_roles are the comma separated roles of the proxy session, default
+	// to the default roles of the end user.
+	stringParam("proxy_roles", func(dsn *DSN) *string { return &dsn.proxy_roles }),
+	// pool_min is the minimum sessions of the session pool, default to 0.
+	uint32Param("pool_min", 0, func(dsn *DSN) *uint32 { return &dsn.pool_min }),
+	// pool_max is the maximum sessions of a session pool, which the
+	// connections of a Connector get their sessions from; no pool when 0, the
+	// default.
+	uint32Param("pool_max", 0, func(dsn *DSN) *uint32 { return &dsn.pool_max }),
+	// pool_increment is the sessions opened at once when the pool grows,
+	// default to 1.
+	uint32Param("pool_increment", 1, func(dsn *DSN) *uint32 { return &dsn.pool_increment }),
+	// pool_timeout is the seconds after which idle sessions are closed,
+	// default to 0 for never.
+	uint32Param("pool_timeout", 0, func(dsn *DSN) *uint32 { return &dsn.pool_timeout }),
+	// pool_wait =WAIT,NOWAIT,FORCEGET, when all sessions are busy, waits,
+	// fails or opens a session above pool_max, default to WAIT.
+	{
+		name: "pool_wait",
+		set: func(dsn *DSN, v string) error {
+			switch v {
+			case "WAIT":
+				dsn.pool_getmode = C.OCI_SPOOL_ATTRVAL_WAIT
+			case "NOWAIT":
+				dsn.pool_getmode = C.OCI_SPOOL_ATTRVAL_NOWAIT
+			case "FORCEGET":
+				dsn.pool_getmode = C.OCI_SPOOL_ATTRVAL_FORCEGET
+			default:
+				return fmt.Errorf("Invalid pool_wait: %v", v)
+			}
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			switch dsn.pool_getmode {
+			case C.OCI_SPOOL_ATTRVAL_NOWAIT:
+				return "NOWAIT"
+			case C.OCI_SPOOL_ATTRVAL_FORCEGET:
+				return "FORCEGET"
+			}
+			return ""
+		},
+	},
+	// pool_stmt_cache_size is the statements cached per session of the pool.
+	uint32Param("pool_stmt_cache_size", 0, func(dsn *DSN) *uint32 { return &dsn.pool_stmt_cache_size }),
+	// pool_connection_class is the DRCP connection class, sessions are shared
+	// only within a class.
+	stringParam("pool_connection_class", func(dsn *DSN) *string { return &dsn.pool_connection_class }),
+	// pool_purity =NEW,SELF is the DRCP purity, a new session or one used
+	// before.
+	{
+		name: "pool_purity",
+		set: func(dsn *DSN, v string) error {
+			switch v {
+			case "NEW":
+				dsn.pool_purity = C.OCI_SESSGET_PURITY_NEW
+			case "SELF":
+				dsn.pool_purity = C.OCI_SESSGET_PURITY_SELF
+			case "DEFAULT":
+				dsn.pool_purity = 0
+			default:
+				return fmt.Errorf("Invalid pool_purity: %v", v)
+			}
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			switch dsn.pool_purity {
+			case C.OCI_SESSGET_PURITY_NEW:
+				return "NEW"
+			case C.OCI_SESSGET_PURITY_SELF:
+				return "SELF"
+			}
+			return ""
+		},
+	},
+	// stmt_cache_size is the statements cached per connection, by their SQL
+	// text, default to 0 for no cache, see StmtCacheStats.
+	uint32Param("stmt_cache_size", 0, func(dsn *DSN) *uint32 { return &dsn.stmt_cache_size }),
+	// reset_packages =YES,NO,TRUE,FALSE resets the state of PL/SQL packages
+	// when database/sql reuses a connection, default to false.
+	boolParam("reset_packages", func(dsn *DSN) *bool { return &dsn.reset_packages }),
+	// call_timeout is the time limit of each round trip, like 30s, default to
+	// 0 for none. The deadline of a context limits the calls made with it as
+	// well, see TimeoutError.
+	{
+		name: "call_timeout",
+		set: func(dsn *DSN, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid call_timeout: %v", v)
+			}
+			if d > 0 && ociMajorVersion < 18 {
+				return clientVersionError("call_timeout", "18")
+			}
+			dsn.call_timeout = d
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			if dsn.call_timeout == 0 {
+				return ""
+			}
+			return dsn.call_timeout.String()
+		},
+	},
+	// questionph =YES,NO,TRUE,FALSE enables question-mark placeholders,
+	// default to false.
+	boolParam("questionph", func(dsn *DSN) *bool { return &dsn.enableQMPlaceholders }),
+	// prefetch_rows and prefetch_memory set the OCI prefetch of queries.
+	uint32Param("prefetch_rows", 0, func(dsn *DSN) *uint32 { return &dsn.prefetch_rows }),
+	uint32Param("prefetch_memory", 0, func(dsn *DSN) *uint32 { return &dsn.prefetch_memory }),
+	// fetch_array_size is the rows fetched per round trip, 1 to 65535, default
+	// to 10, lowered for wide rows to keep the fetch array within 16 MiB.
+	uint32RangeParam("fetch_array_size", 1, maxFetchArraySize, func(dsn *DSN) *uint32 { return &dsn.fetch_array_size }),
+	// tns_admin is the directory of tnsnames.ora, to resolve an alias in the
+	// driver instead of OCI, see ResolveTNSAlias. By default aliases found in
+	// the tnsnames.ora of $TNS_ADMIN or $ORACLE_HOME/network/admin are
+	// resolved, the others are left to OCI.
+	stringParam("tns_admin", func(dsn *DSN) *string { return &dsn.tns_admin }),
+	// strict =YES,NO,TRUE,FALSE fails on unknown and duplicate parameters.
+	boolParam("strict", func(dsn *DSN) *bool { return &dsn.strict }),
+	// external_auth =YES,NO,TRUE,FALSE logs on with external credentials, by
+	// the OS or a wallet, instead of the password; set by "/@connect". Without
+	// it, a DSN with neither username nor password fails to connect.
+	boolParam("external_auth", func(dsn *DSN) *bool { return &dsn.external_auth }),
+	// wallet_location is the directory of the Oracle wallet, for TCPS and for
+	// the credentials of external_auth. It needs an EZConnect or descriptor
+	// connect string, or an alias resolved by a tnsnames.ora, see tns_admin.
+	stringParam("wallet_location", func(dsn *DSN) *string { return &dsn.wallet_location }),
+}
+
+// privileges are the administrative privileges of the 'as' parameter, by
+// mode of OCISessionBegin.
+var privileges = map[C.ub4]string{
+	C.OCI_SYSDBA:  "sysdba",
+	C.OCI_SYSOPER: "sysoper",
+	C.OCI_SYSBKP:  "sysbackup",
+	C.OCI_SYSDGD:  "sysdg",
+	C.OCI_SYSKMT:  "syskm",
+	C.OCI_SYSASM:  "sysasm",
+}
+
+// dsnParamsByName indexes dsnParams.
+var dsnParamsByName = map[string]*dsnParam{}
+
+func init() {
+	for i := range dsnParams {
+		dsnParamsByName[dsnParams[i].name] = &dsnParams[i]
+	}
+}
+
+// boolParam is a parameter of YES,NO,TRUE,FALSE, default to false.
+func boolParam(name string, field func(dsn *DSN) *bool) dsnParam {
+	return dsnParam{
+		name: name,
+		set: func(dsn *DSN, v string) error {
+			switch v {
+			case "YES", "TRUE":
+				*field(dsn) = true
+			case "NO", "FALSE":
+				*field(dsn) = false
+			default:
+				return fmt.Errorf("Invalid %v: %v", name, v)
+			}
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			if *field(dsn) {
+				return "YES"
+			}
+			return ""
+		},
+	}
+}
+
+// uint32Param is a parameter of at least min, default to the value of
+// NewDSN.
+func uint32Param(name string, min uint64, field func(dsn *DSN) *uint32) dsnParam {
+	return uint32RangeParam(name, min, math.MaxUint32, field)
+}
+
+// uint32RangeParam is a parameter of min to max, default to the value of
+// NewDSN.
+func uint32RangeParam(name string, min, max uint64, field func(dsn *DSN) *uint32) dsnParam {
+	return dsnParam{
+		name: name,
+		set: func(dsn *DSN, v string) error {
+			z, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || z < min || z > max {
+				return fmt.Errorf("invalid %v: %v", name, v)
+			}
+			*field(dsn) = uint32(z)
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			if z := *field(dsn); z != *field(NewDSN()) {
+				return strconv.FormatUint(uint64(z), 10)
+			}
+			return ""
+		},
+	}
+}
+
+// stringParam is a parameter of any value, default to empty.
+func stringParam(name string, field func(dsn *DSN) *string) dsnParam {
+	return dsnParam{
+		name: name,
+		set: func(dsn *DSN, v string) error {
+			*field(dsn) = v
+			return nil
+		},
+		get: func(dsn *DSN) string {
+			return *field(dsn)
+		},
+	}
+}
+
+// NewDSN returns a DSN with default parameters, to build a Connector without
+// formatting a DSN string.
+func NewDSN() *DSN {
+	return &DSN{
+		Location: time.Local,
+		// set safe defaults
+		prefetch_rows:    10,
+		prefetch_memory:  0,
+		fetch_array_size: 10,
+	}
+}
+
+// SetParam sets the DSN parameter key, as given in the query string of a
+// DSN, to value.
+func (dsn *DSN) SetParam(key, value string) error {
+	p, ok := dsnParamsByName[key]
+	if !ok {
+		return unknownParamError(key, value)
+	}
+	if err := p.set(dsn, value); err != nil {
+		return &DSNError{Param: key, Value: value, Reason: err.Error()}
+	}
+	return nil
+}
+
+// setParams sets the parameters of the DSN query string query. Unknown and
+// duplicate parameters are errors when strict, or when the 'strict'
+// parameter is set.
+func (dsn *DSN) setParams(query string, strict bool) error {
+	params, err := parseParams(query)
+	if err != nil {
+		return err
+	}
+	var ignored error
+	seen := map[string]bool{}
+	for _, kv := range params {
+		k, v := kv[0], kv[1]
+		if seen[strings.ToLower(k)] {
+			if ignored == nil {
+				ignored = &DSNError{Param: k, Value: v, Reason: "duplicate parameter"}
+			}
+			continue
+		}
+		seen[strings.ToLower(k)] = true
+
+		if ezConnectOptions[strings.ToLower(k)] {
+			if dsn.EZConnect == nil {
+				return &DSNError{Param: k, Value: v, Reason: "needs an EZConnect connect string"}
+			}
+			if dsn.EZConnect.Options == nil {
+				dsn.EZConnect.Options = Values{}
+			}
+			dsn.EZConnect.Options.Set(k, v)
+			continue
+		}
+		if _, ok := dsnParamsByName[k]; !ok {
+			if ignored == nil {
+				ignored = unknownParamError(k, v)
+			}
+			continue
+		}
+		if err := dsn.SetParam(k, v); err != nil {
+			return err
+		}
+	}
+	if strict || dsn.strict {
+		return ignored
+	}
+	return nil
+}
+
+// params returns the parameters of dsn not at their default.
+func (dsn *DSN) params() Values {
+	v := Values{}
+	for _, p := range dsnParams {
+		if s := p.get(dsn); s != "" {
+			v.Set(p.name, s)
+		}
+	}
+	return v
+}
+
+func unknownParamError(k, v string) error {
+	e := &DSNError{Param: k, Value: v, Reason: "unknown parameter"}
+	known := make([]string, 0, len(dsnParams)+len(ezConnectOptions))
+	for _, p := range dsnParams {
+		known = append(known, p.name)
+	}
+	for name := range ezConnectOptions {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+	best := 4 // suggest only keys up to 3 edits away
+	for _, name := range known {
+		if d := editDistance(strings.ToLower(k), name); d < best {
+			e.Closest, best = name, d
+		}
+	}
+	return e
+}
+
+// editDistance is the Levenshtein distance of a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,312 @@
+package oci8
+
+/*
+#include <oci.h>
+#include <stdlib.h>
+
+typedef struct {
+  OCISPool *pool;
+  OraText *name;
+  ub4 namelen;
+  sword rv;
+} retPool;
+
+// WrapOCISessionPoolCreate creates a session pool of mn to mx sessions to
+// the database h, and sets its attributes.
+static retPool
+WrapOCISessionPoolCreate(OCIEnv *env, OCIError *err, OraText *h, ub4 hlen, ub4 mn, ub4 mx, ub4 incr, OraText *u, ub4 ulen, OraText *p, ub4 plen, ub4 mode, ub4 timeout, ub4 getmode, ub4 stmtcache) {
+  retPool vvv = {NULL, NULL, 0, 0};
+  if ((vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.pool, OCI_HTYPE_SPOOL, 0, NULL)) != OCI_SUCCESS) {
+    vvv.pool = NULL;
+    return vvv;
+  }
+  vvv.rv = OCISessionPoolCreate(env, err, vvv.pool, &vvv.name, &vvv.namelen, h, hlen, mn, mx, incr, u, ulen, p, plen, mode);
+  if (vvv.rv != OCI_SUCCESS && vvv.rv != OCI_SUCCESS_WITH_INFO) {
+    OCIHandleFree(vvv.pool, OCI_HTYPE_SPOOL);
+    vvv.pool = NULL;
+    return vvv;
+  }
+  if ((vvv.rv = OCIAttrSet(vvv.pool, OCI_HTYPE_SPOOL, &timeout, 0, OCI_ATTR_SPOOL_TIMEOUT, err)) != OCI_SUCCESS ||
+      (vvv.rv = OCIAttrSet(vvv.pool, OCI_HTYPE_SPOOL, &getmode, 0, OCI_ATTR_SPOOL_GETMODE, err)) != OCI_SUCCESS ||
+      (stmtcache > 0 && (vvv.rv = OCIAttrSet(vvv.pool, OCI_HTYPE_SPOOL, &stmtcache, 0, OCI_ATTR_SPOOL_STMTCACHESIZE, err)) != OCI_SUCCESS)) {
+    OCISessionPoolDestroy(vvv.pool, err, OCI_SPD_FORCE);
+    OCIHandleFree(vvv.pool, OCI_HTYPE_SPOOL);
+    vvv.pool = NULL;
+  }
+  return vvv;
+}
+
+typedef struct {
+  OCISvcCtx *svc;
+  OCIAuthInfo *auth;
+  sword rv;
+} retSvc;
+
+// WrapOCISessionGet gets a session of the session pool or database db. An
+// auth info handle is allocated for the user u with password p and for the
+// connection class cc, when they are not NULL.
+static retSvc
+WrapOCISessionGet(OCIEnv *env, OCIError *err, OraText *db, ub4 dblen, OraText *u, ub4 ulen, OraText *p, ub4 plen, OraText *cc, ub4 cclen, ub4 mode) {
+  retSvc vvv = {NULL, NULL, 0};
+  boolean found;
+  if (u != NULL || cc != NULL) {
+    if ((vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.auth, OCI_HTYPE_AUTHINFO, 0, NULL)) != OCI_SUCCESS) {
+      vvv.auth = NULL;
+      return vvv;
+    }
+    if ((u != NULL &&
+         ((vvv.rv = OCIAttrSet(vvv.auth, OCI_HTYPE_AUTHINFO, u, ulen, OCI_ATTR_USERNAME, err)) != OCI_SUCCESS ||
+          (vvv.rv = OCIAttrSet(vvv.auth, OCI_HTYPE_AUTHINFO, p, plen, OCI_ATTR_PASSWORD, err)) != OCI_SUCCESS)) ||
+        (cc != NULL && (vvv.rv = OCIAttrSet(vvv.auth, OCI_HTYPE_AUTHINFO, cc, cclen, OCI_ATTR_CONNECTION_CLASS, err)) != OCI_SUCCESS)) {
+      goto fail;
+    }
+  }
+  vvv.rv = OCISessionGet(env, err, &vvv.svc, vvv.auth, db, dblen, NULL, 0, NULL, NULL, &found, mode);
+  if (vvv.rv == OCI_SUCCESS || vvv.rv == OCI_SUCCESS_WITH_INFO) {
+    return vvv;
+  }
+fail:
+  if (vvv.auth) OCIHandleFree(vvv.auth, OCI_HTYPE_AUTHINFO);
+  vvv.auth = NULL;
+  vvv.svc = NULL;
+  return vvv;
+}
+*/
+import "C"
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// sessionPool is an OCI session pool, which the connections of a Connector
+// get their sessions from. The Connector and each connection hold a
+// reference to it, the last release destroys it.
+type sessionPool struct {
+	env      unsafe.Pointer
+	err      unsafe.Pointer
+	pool     *C.OCISPool
+	name     string
+	mode     C.ub4 // of OCISessionGet
+	dsn      *DSN
+	username string // the pool logs on with
+	password string
+	mu       sync.Mutex
+	refs     int
+}
+
+// newSessionPool creates the session pool of dsn, where username and
+// password are those of dsn.credentials. The pool has one reference, of
+// the caller.
+func newSessionPool(dsn *DSN, username, password string) (*sessionPool, error) {
+	if dsn.pool_min > dsn.pool_max {
+		return nil, fmt.Errorf("oci8: pool_min %d is greater than pool_max %d", dsn.pool_min, dsn.pool_max)
+	}
+	if dsn.ChangePassword != nil {
+		return nil, errors.New("oci8: ChangePassword is not supported with a session pool")
+	}
+	mode, err := dsn.sessionGetMode(username, password)
+	if err != nil {
+		return nil, err
+	}
+	p := &sessionPool{dsn: dsn, mode: mode | C.OCI_SESSGET_SPOOL, username: username, password: password, refs: 1}
+	if mode&C.OCI_SESSGET_CREDEXT != 0 {
+		username, password = "", ""
+	}
+	increment := dsn.pool_increment
+	if increment == 0 {
+		increment = 1
+	}
+	createMode := C.ub4(C.OCI_SPC_HOMOGENEOUS)
+	if dsn.pool_stmt_cache_size > 0 {
+		createMode |= C.OCI_SPC_STMTCACHE
+		p.mode |= C.OCI_SESSGET_STMTCACHE
+	}
+
+	if p.env, p.err, err = acquireEnv(); err != nil {
+		return nil, err
+	}
+
+	connect := dsn.connectString()
+	phost := C.CString(connect)
+	defer C.free(unsafe.Pointer(phost))
+	puser := C.CString(username)
+	defer C.free(unsafe.Pointer(puser))
+	ppass := C.CString(password)
+	defer C.free(unsafe.Pointer(ppass))
+
+	rv := C.WrapOCISessionPoolCreate(
+		(*C.OCIEnv)(p.env),
+		(*C.OCIError)(p.err),
+		(*C.OraText)(unsafe.Pointer(phost)),
+		C.ub4(len(connect)),
+		C.ub4(dsn.pool_min),
+		C.ub4(dsn.pool_max),
+		C.ub4(increment),
+		(*C.OraText)(unsafe.Pointer(puser)),
+		C.ub4(len(username)),
+		(*C.OraText)(unsafe.Pointer(ppass)),
+		C.ub4(len(password)),
+		createMode,
+		C.ub4(dsn.pool_timeout),
+		dsn.pool_getmode,
+		C.ub4(dsn.pool_stmt_cache_size))
+	if rv.rv != C.OCI_SUCCESS && rv.rv != C.OCI_SUCCESS_WITH_INFO {
+		err := ociGetError(rv.rv, p.err)
+		releaseEnv(p.err)
+		return nil, err
+	}
+	p.pool = rv.pool
+	p.name = C.GoStringN((*C.char)(unsafe.Pointer(rv.name)), C.int(rv.namelen))
+	return p, nil
+}
+
+// get returns a connection with a session of the pool. It takes over a
+// reference to the pool, of acquire, which the connection releases on
+// Close, or get when it fails.
+func (p *sessionPool) get() (driver.Conn, error) {
+	conn := &OCI8Conn{}
+	var err error
+	if conn.env, conn.err, err = acquireEnv(); err != nil {
+		p.release()
+		return nil, err
+	}
+	if rv := conn.sessionGet(p.name, nil, p.dsn.pool_connection_class, p.mode); rv != C.OCI_SUCCESS && rv != C.OCI_SUCCESS_WITH_INFO {
+		err := ociGetError(rv, conn.err)
+		releaseEnv(conn.err)
+		p.release()
+		return nil, err
+	}
+	conn.pool = p
+	if err = p.dsn.initConn(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if conn.stmt_cache_size == 0 {
+		conn.stmt_cache_size = p.dsn.pool_stmt_cache_size
+	}
+	return conn, nil
+}
+
+// sessionGetMode returns the mode of OCISessionGet for dsn, where username
+// and password are those of dsn.credentials.
+func (dsn *DSN) sessionGetMode(username, password string) (C.ub4, error) {
+	if dsn.EndUser != "" {
+		return 0, errors.New("oci8: proxy authentication is not supported with a session pool nor DRCP")
+	}
+	mode := dsn.pool_purity
+	switch dsn.privilege {
+	case 0:
+	case C.OCI_SYSDBA:
+		mode |= C.OCI_SESSGET_SYSDBA
+	default:
+		return 0, fmt.Errorf("oci8: as=%s is not supported with a session pool nor DRCP", privileges[dsn.privilege])
+	}
+	if dsn.external_auth {
+		mode |= C.OCI_SESSGET_CREDEXT
+	}
+	return mode, nil
+}
+
+// sessionGet gets a session of the session pool or database db, with the
+// credentials user, a username and password, and the DRCP connection class
+// when not empty.
+func (c *OCI8Conn) sessionGet(db string, user *[2]string, class string, mode C.ub4) C.sword {
+	pdb := C.CString(db)
+	defer C.free(unsafe.Pointer(pdb))
+	var puser, ppass, pclass *C.char
+	var ulen, plen C.ub4
+	if user != nil {
+		puser = C.CString(user[0])
+		defer C.free(unsafe.Pointer(puser))
+		ppass = C.CString(user[1])
+		defer C.free(unsafe.Pointer(ppass))
+		ulen, plen = C.ub4(len(user[0])), C.ub4(len(user[1]))
+	}
+	if class != "" {
+		pclass = C.CString(class)
+		defer C.free(unsafe.Pointer(pclass))
+	}
+
+	rv := C.WrapOCISessionGet(
+		(*C.OCIEnv)(c.env),
+		(*C.OCIError)(c.err),
+		(*C.OraText)(unsafe.Pointer(pdb)),
+		C.ub4(len(db)),
+		(*C.OraText)(unsafe.Pointer(puser)),
+		ulen,
+		(*C.OraText)(unsafe.Pointer(ppass)),
+		plen,
+		(*C.OraText)(unsafe.Pointer(pclass)),
+		C.ub4(len(class)),
+		mode)
+	if rv.rv == C.OCI_SUCCESS || rv.rv == C.OCI_SUCCESS_WITH_INFO {
+		c.svc = unsafe.Pointer(rv.svc)
+		c.auth = unsafe.Pointer(rv.auth)
+	}
+	return rv.rv
+}
+
+// releaseSession releases the session of OCISessionGet, to the session pool
+// or DRCP.
+func (c *OCI8Conn) releaseSession() error {
+	var err error
+	if rv := C.OCISessionRelease(
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCIError)(c.err),
+		nil,
+		0,
+		C.OCI_DEFAULT); rv != C.OCI_SUCCESS {
+		err = ociGetError(rv, c.err)
+	}
+	if c.auth != nil {
+		C.OCIHandleFree(c.auth, C.OCI_HTYPE_AUTHINFO)
+		c.auth = nil
+	}
+	return err
+}
+
+// acquire takes a reference to the pool.
+func (p *sessionPool) acquire() {
+	p.mu.Lock()
+	p.refs++
+	p.mu.Unlock()
+}
+
+// release releases a reference to the pool, destroying the pool on the
+// last one.
+func (p *sessionPool) release() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refs--; p.refs > 0 {
+		return nil
+	}
+	return p.destroy()
+}
+
+// destroy destroys the pool, which has no sessions out. When that fails
+// even by force, the pool and its environment are kept rather than freed
+// under OCI.
+func (p *sessionPool) destroy() error {
+	rv := C.OCISessionPoolDestroy(
+		p.pool,
+		(*C.OCIError)(p.err),
+		C.OCI_DEFAULT)
+	if rv != C.OCI_SUCCESS {
+		err := ociGetError(rv, p.err)
+		if rv = C.OCISessionPoolDestroy(
+			p.pool,
+			(*C.OCIError)(p.err),
+			C.OCI_SPD_FORCE); rv != C.OCI_SUCCESS {
+			return err
+		}
+	}
+	C.OCIHandleFree(unsafe.Pointer(p.pool), C.OCI_HTYPE_SPOOL)
+	releaseEnv(p.err)
+	p.pool = nil
+	p.env = nil
+	return nil
+}
@@ -0,0 +1,122 @@
+package oci8
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// savepoint names are spliced into SQL text, so only plain identifiers are
+// allowed.
+var savepointName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]{0,127}$`)
+
+var errNoTransaction = errors.New("oci8: savepoint outside of transaction")
+
+// Savepoint marks a savepoint name in the current transaction. A savepoint
+// of the same name marked before is replaced.
+//
+// Savepoints are also available on the connection, e.g. through
+// sql.Conn.Raw while a transaction begun on that sql.Conn is open.
+func (tx *OCI8Tx) Savepoint(name string) error {
+	return tx.c.Savepoint(name)
+}
+
+// RollbackTo rolls back the current transaction to the savepoint name. The
+// savepoint stays valid, savepoints marked after it are erased.
+func (tx *OCI8Tx) RollbackTo(name string) error {
+	return tx.c.RollbackTo(name)
+}
+
+// Release forgets the savepoint name and savepoints marked after it.
+func (tx *OCI8Tx) Release(name string) error {
+	return tx.c.Release(name)
+}
+
+// InSavepoint runs f inside the savepoint name, rolling back to it when f
+// fails.
+func (tx *OCI8Tx) InSavepoint(name string, f func() error) error {
+	return tx.c.InSavepoint(name, f)
+}
+
+// Savepoint implement OCI8Tx.Savepoint for the open transaction of c.
+func (c *OCI8Conn) Savepoint(name string) error {
+	if err := c.checkSavepoint(name); err != nil {
+		return err
+	}
+	if _, err := c.exec(context.Background(), "SAVEPOINT "+name, nil); err != nil {
+		return err
+	}
+	if i := c.savepointIndex(name); i >= 0 {
+		c.savepoints = append(c.savepoints[:i], c.savepoints[i+1:]...)
+	}
+	c.savepoints = append(c.savepoints, name)
+	return nil
+}
+
+// RollbackTo implement OCI8Tx.RollbackTo for the open transaction of c.
+func (c *OCI8Conn) RollbackTo(name string) error {
+	if err := c.checkSavepoint(name); err != nil {
+		return err
+	}
+	i := c.savepointIndex(name)
+	if i < 0 {
+		return fmt.Errorf("oci8: unknown savepoint %s", name)
+	}
+	if _, err := c.exec(context.Background(), "ROLLBACK TO SAVEPOINT "+name, nil); err != nil {
+		return err
+	}
+	c.savepoints = c.savepoints[:i+1]
+	return nil
+}
+
+// Release implement OCI8Tx.Release for the open transaction of c. Oracle
+// has no RELEASE SAVEPOINT, savepoints end with the transaction, so this
+// only stops RollbackTo from using them.
+func (c *OCI8Conn) Release(name string) error {
+	if err := c.checkSavepoint(name); err != nil {
+		return err
+	}
+	i := c.savepointIndex(name)
+	if i < 0 {
+		return fmt.Errorf("oci8: unknown savepoint %s", name)
+	}
+	c.savepoints = c.savepoints[:i]
+	return nil
+}
+
+// InSavepoint implement OCI8Tx.InSavepoint for the open transaction of c.
+func (c *OCI8Conn) InSavepoint(name string, f func() error) error {
+	if err := c.Savepoint(name); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		if rerr := c.RollbackTo(name); rerr != nil {
+			return fmt.Errorf("%v; rollback to savepoint %s: %v", err, name, rerr)
+		}
+		c.Release(name)
+		return err
+	}
+	return c.Release(name)
+}
+
+func (c *OCI8Conn) checkSavepoint(name string) error {
+	if !c.inTransaction {
+		return errNoTransaction
+	}
+	if !savepointName.MatchString(name) {
+		return fmt.Errorf("oci8: invalid savepoint name %q", name)
+	}
+	return nil
+}
+
+func (c *OCI8Conn) savepointIndex(name string) int {
+	for i, sp := range c.savepoints {
+		if strings.EqualFold(sp, name) {
+			return i
+		}
+	}
+	return -1
+}
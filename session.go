@@ -0,0 +1,245 @@
+package oci8
+
+/*
+#include <oci.h>
+#include <stdlib.h>
+
+typedef struct {
+  OCISvcCtx *svc;
+  OCIServer *srv;
+  OCISession *usr;
+  sword rv;
+} retSession;
+
+// WrapOCISessionLogon attaches to the server h and begins a session of user
+// u with password p, or with external credentials when cred is
+// OCI_CRED_EXT. When np is not NULL, the expired password p is changed to np.
+static retSession
+WrapOCISessionLogon(OCIEnv *env, OCIError *err, OraText *u, ub4 ulen, OraText *p, ub4 plen, OraText *np, ub4 nplen, OraText *h, ub4 hlen, ub4 cred, ub4 mode) {
+  retSession vvv = {NULL, NULL, NULL, 0};
+  int attached = 0;
+  if ((vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.srv, OCI_HTYPE_SERVER, 0, NULL)) != OCI_SUCCESS ||
+      (vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.svc, OCI_HTYPE_SVCCTX, 0, NULL)) != OCI_SUCCESS ||
+      (vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.usr, OCI_HTYPE_SESSION, 0, NULL)) != OCI_SUCCESS) {
+    goto fail;
+  }
+  if ((vvv.rv = OCIServerAttach(vvv.srv, err, h, hlen, OCI_DEFAULT)) != OCI_SUCCESS) {
+    goto fail;
+  }
+  attached = 1;
+  if ((vvv.rv = OCIAttrSet(vvv.svc, OCI_HTYPE_SVCCTX, vvv.srv, 0, OCI_ATTR_SERVER, err)) != OCI_SUCCESS) {
+    goto fail;
+  }
+  if (np != NULL) {
+    if ((vvv.rv = OCIAttrSet(vvv.svc, OCI_HTYPE_SVCCTX, vvv.usr, 0, OCI_ATTR_SESSION, err)) != OCI_SUCCESS) {
+      goto fail;
+    }
+    vvv.rv = OCIPasswordChange(vvv.svc, err, u, ulen, p, plen, np, nplen, OCI_AUTH);
+  } else {
+    if (cred == OCI_CRED_RDBMS) {
+      if ((vvv.rv = OCIAttrSet(vvv.usr, OCI_HTYPE_SESSION, u, ulen, OCI_ATTR_USERNAME, err)) != OCI_SUCCESS ||
+          (vvv.rv = OCIAttrSet(vvv.usr, OCI_HTYPE_SESSION, p, plen, OCI_ATTR_PASSWORD, err)) != OCI_SUCCESS) {
+        goto fail;
+      }
+    }
+    vvv.rv = OCISessionBegin(vvv.svc, err, vvv.usr, cred, mode);
+    if (vvv.rv == OCI_SUCCESS || vvv.rv == OCI_SUCCESS_WITH_INFO) {
+      sword rv = OCIAttrSet(vvv.svc, OCI_HTYPE_SVCCTX, vvv.usr, 0, OCI_ATTR_SESSION, err);
+      if (rv != OCI_SUCCESS) {
+        OCISessionEnd(vvv.svc, err, vvv.usr, OCI_DEFAULT);
+        vvv.rv = rv;
+      }
+    }
+  }
+  if (vvv.rv == OCI_SUCCESS || vvv.rv == OCI_SUCCESS_WITH_INFO) {
+    return vvv;
+  }
+fail:
+  if (attached) {
+    OCIServerDetach(vvv.srv, err, OCI_DEFAULT);
+  }
+  if (vvv.usr) OCIHandleFree(vvv.usr, OCI_HTYPE_SESSION);
+  if (vvv.svc) OCIHandleFree(vvv.svc, OCI_HTYPE_SVCCTX);
+  if (vvv.srv) OCIHandleFree(vvv.srv, OCI_HTYPE_SERVER);
+  vvv.svc = NULL;
+  vvv.srv = NULL;
+  vvv.usr = NULL;
+  return vvv;
+}
+
+// WrapOCIProxySession begins a session of user u on svc, authenticated by
+// the session proxy of the proxy user, with the roles.
+static retSession
+WrapOCIProxySession(OCIEnv *env, OCIError *err, OCISvcCtx *svc, OCISession *proxy, OraText *u, ub4 ulen, OraText **roles, ub4 nroles, ub4 mode) {
+  retSession vvv = {svc, NULL, NULL, 0};
+  if ((vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.usr, OCI_HTYPE_SESSION, 0, NULL)) != OCI_SUCCESS) {
+    vvv.usr = NULL;
+    return vvv;
+  }
+  if ((vvv.rv = OCIAttrSet(vvv.usr, OCI_HTYPE_SESSION, u, ulen, OCI_ATTR_USERNAME, err)) != OCI_SUCCESS ||
+      (vvv.rv = OCIAttrSet(vvv.usr, OCI_HTYPE_SESSION, proxy, 0, OCI_ATTR_PROXY_CREDENTIALS, err)) != OCI_SUCCESS ||
+      (nroles > 0 && (vvv.rv = OCIAttrSet(vvv.usr, OCI_HTYPE_SESSION, roles, nroles, OCI_ATTR_INITIAL_CLIENT_ROLES, err)) != OCI_SUCCESS)) {
+    goto fail;
+  }
+  vvv.rv = OCISessionBegin(svc, err, vvv.usr, OCI_CRED_PROXY, mode);
+  if (vvv.rv != OCI_SUCCESS && vvv.rv != OCI_SUCCESS_WITH_INFO) {
+    goto fail;
+  }
+  if ((vvv.rv = OCIAttrSet(svc, OCI_HTYPE_SVCCTX, vvv.usr, 0, OCI_ATTR_SESSION, err)) != OCI_SUCCESS) {
+    OCISessionEnd(svc, err, vvv.usr, OCI_DEFAULT);
+    goto fail;
+  }
+  return vvv;
+fail:
+  OCIHandleFree(vvv.usr, OCI_HTYPE_SESSION);
+  vvv.usr = NULL;
+  return vvv;
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+// sessionParams are the parameters of a logon by sessionLogon.
+type sessionParams struct {
+	connect     string
+	username    string
+	password    string
+	newPassword string // changes the expired password when set
+	cred        C.ub4  // OCI_CRED_RDBMS or OCI_CRED_EXT
+	mode        C.ub4  // of OCISessionBegin
+}
+
+// sessionLogon attaches to the server and begins a session, with
+// OCIServerAttach and OCISessionBegin. It returns the result of
+// OCISessionBegin, on success the connection is set up.
+func (c *OCI8Conn) sessionLogon(p *sessionParams) C.sword {
+	puser := C.CString(p.username)
+	defer C.free(unsafe.Pointer(puser))
+	ppass := C.CString(p.password)
+	defer C.free(unsafe.Pointer(ppass))
+	phost := C.CString(p.connect)
+	defer C.free(unsafe.Pointer(phost))
+	var pnew *C.char
+	if p.newPassword != "" {
+		pnew = C.CString(p.newPassword)
+		defer C.free(unsafe.Pointer(pnew))
+	}
+
+	rv := C.WrapOCISessionLogon(
+		(*C.OCIEnv)(c.env),
+		(*C.OCIError)(c.err),
+		(*C.OraText)(unsafe.Pointer(puser)),
+		C.ub4(len(p.username)),
+		(*C.OraText)(unsafe.Pointer(ppass)),
+		C.ub4(len(p.password)),
+		(*C.OraText)(unsafe.Pointer(pnew)),
+		C.ub4(len(p.newPassword)),
+		(*C.OraText)(unsafe.Pointer(phost)),
+		C.ub4(len(p.connect)),
+		p.cred,
+		p.mode)
+	if rv.rv == C.OCI_SUCCESS || rv.rv == C.OCI_SUCCESS_WITH_INFO {
+		c.svc = unsafe.Pointer(rv.svc)
+		c.srv = unsafe.Pointer(rv.srv)
+		c.usr = unsafe.Pointer(rv.usr)
+	}
+	return rv.rv
+}
+
+// proxyLogon begins a session of the end user, authenticated by the
+// session of the proxy user, which stays open until the connection is
+// closed. The end user session gets roles, or its default roles when empty.
+func (c *OCI8Conn) proxyLogon(user string, roles []string, mode C.ub4) error {
+	puser := C.CString(user)
+	defer C.free(unsafe.Pointer(puser))
+	var proles **C.OraText
+	if len(roles) > 0 {
+		proles = (**C.OraText)(C.malloc(C.size_t(len(roles)) * C.size_t(unsafe.Sizeof(proles))))
+		defer C.free(unsafe.Pointer(proles))
+		a := (*[1 << 16]*C.OraText)(unsafe.Pointer(proles))[:len(roles):len(roles)]
+		for i, role := range roles {
+			a[i] = (*C.OraText)(unsafe.Pointer(C.CString(role)))
+			defer C.free(unsafe.Pointer(a[i]))
+		}
+	}
+
+	rv := C.WrapOCIProxySession(
+		(*C.OCIEnv)(c.env),
+		(*C.OCIError)(c.err),
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCISession)(c.usr),
+		(*C.OraText)(unsafe.Pointer(puser)),
+		C.ub4(len(user)),
+		proles,
+		C.ub4(len(roles)),
+		mode)
+	if rv.rv != C.OCI_SUCCESS && rv.rv != C.OCI_SUCCESS_WITH_INFO {
+		return ociGetError(rv.rv, c.err)
+	}
+	c.proxy = c.usr
+	c.usr = unsafe.Pointer(rv.usr)
+	return nil
+}
+
+// changePassword changes the password of the logged on username.
+func (c *OCI8Conn) changePassword(username, password, newPassword string) error {
+	puser := C.CString(username)
+	defer C.free(unsafe.Pointer(puser))
+	ppass := C.CString(password)
+	defer C.free(unsafe.Pointer(ppass))
+	pnew := C.CString(newPassword)
+	defer C.free(unsafe.Pointer(pnew))
+
+	if rv := C.OCIPasswordChange(
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCIError)(c.err),
+		(*C.OraText)(unsafe.Pointer(puser)),
+		C.ub4(len(username)),
+		(*C.OraText)(unsafe.Pointer(ppass)),
+		C.ub4(len(password)),
+		(*C.OraText)(unsafe.Pointer(pnew)),
+		C.ub4(len(newPassword)),
+		C.OCI_DEFAULT); rv != C.OCI_SUCCESS && rv != C.OCI_SUCCESS_WITH_INFO {
+		return ociGetError(rv, c.err)
+	}
+	return nil
+}
+
+// endSession ends the session, and that of the proxy user, detaches the
+// server and frees their handles.
+func (c *OCI8Conn) endSession() error {
+	var err error
+	for _, usr := range []unsafe.Pointer{c.usr, c.proxy} {
+		if usr == nil {
+			continue
+		}
+		if rv := C.OCISessionEnd(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			(*C.OCISession)(usr),
+			C.OCI_DEFAULT); rv != C.OCI_SUCCESS && err == nil {
+			err = ociGetError(rv, c.err)
+		}
+	}
+	if rv := C.OCIServerDetach(
+		(*C.OCIServer)(c.srv),
+		(*C.OCIError)(c.err),
+		C.OCI_DEFAULT); rv != C.OCI_SUCCESS && err == nil {
+		err = ociGetError(rv, c.err)
+	}
+	for _, usr := range []unsafe.Pointer{c.usr, c.proxy} {
+		if usr != nil {
+			C.OCIHandleFree(usr, C.OCI_HTYPE_SESSION)
+		}
+	}
+	C.OCIHandleFree(c.svc, C.OCI_HTYPE_SVCCTX)
+	C.OCIHandleFree(c.srv, C.OCI_HTYPE_SERVER)
+	c.svc = nil
+	c.srv = nil
+	c.usr = nil
+	c.proxy = nil
+	return err
+}
@@ -0,0 +1,107 @@
+package oci8
+
+/*
+#include <oci.h>
+#include <stdlib.h>
+
+typedef struct {
+  OCIStmt *stmt;
+  sword rv;
+} retStmt;
+
+// WrapOCIStmtPrepare2 prepares the statement q, with q as key of the
+// statement cache.
+static retStmt
+WrapOCIStmtPrepare2(OCISvcCtx *svc, OCIError *err, OraText *q, ub4 qlen, ub4 mode) {
+  retStmt vvv = {NULL, 0};
+  vvv.rv = OCIStmtPrepare2(svc, &vvv.stmt, err, q, qlen, q, qlen, OCI_NTV_SYNTAX, mode);
+  return vvv;
+}
+*/
+import "C"
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+// StmtCacheStats are the statement cache hits and misses of a connection.
+// Prepares are counted only when the statement cache is enabled, by the
+// DSN parameter stmt_cache_size or pool_stmt_cache_size.
+type StmtCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// StmtCacheStats returns the statement cache hits and misses of c. Use
+// sql.Conn.Raw to get at the OCI8Conn.
+func (c *OCI8Conn) StmtCacheStats() StmtCacheStats {
+	return StmtCacheStats{Hits: c.stmtCacheHits, Misses: c.stmtCacheMisses}
+}
+
+// prepareStmt prepares query by OCIStmtPrepare2, which takes the statement
+// from the statement cache when it is there.
+func (c *OCI8Conn) prepareStmt(query string) (*OCI8Stmt, error) {
+	pquery := C.CString(query)
+	defer C.free(unsafe.Pointer(pquery))
+
+	var rv C.retStmt
+	if c.stmt_cache_size > 0 {
+		rv = C.WrapOCIStmtPrepare2(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			(*C.OraText)(unsafe.Pointer(pquery)),
+			C.ub4(len(query)),
+			C.OCI_PREP2_CACHE_SEARCHONLY)
+		if rv.rv == C.OCI_SUCCESS {
+			c.stmtCacheHits++
+		} else {
+			c.stmtCacheMisses++
+		}
+	}
+	if rv.stmt == nil {
+		rv = C.WrapOCIStmtPrepare2(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			(*C.OraText)(unsafe.Pointer(pquery)),
+			C.ub4(len(query)),
+			C.OCI_DEFAULT)
+		if rv.rv != C.OCI_SUCCESS {
+			return nil, withSQL(ociGetError(rv.rv, c.err), query)
+		}
+	}
+
+	// room for the bind and define handles, which allocStmt puts in the
+	// handle memory
+	bp := C.malloc(C.size_t(unsafe.Sizeof(unsafe.Pointer(nil)) * 2))
+	defp := unsafe.Pointer(uintptr(bp) + unsafe.Sizeof(unsafe.Pointer(nil)))
+
+	ss := &OCI8Stmt{c: c, s: unsafe.Pointer(rv.stmt), sql: query, cached: true, bp: (**C.OCIBind)(bp), defp: (**C.OCIDefine)(defp)}
+	runtime.SetFinalizer(ss, (*OCI8Stmt).Close)
+	return ss, nil
+}
+
+// release releases the statement of prepareStmt to the statement cache.
+// After the connection is closed only the memory of the statement is freed,
+// the statement went with the session.
+func (s *OCI8Stmt) release() error {
+	if s.c.closed {
+		C.free(unsafe.Pointer(s.bp))
+		return nil
+	}
+
+	pquery := C.CString(s.sql)
+	defer C.free(unsafe.Pointer(pquery))
+
+	var err error
+	if rv := C.OCIStmtRelease(
+		(*C.OCIStmt)(s.s),
+		(*C.OCIError)(s.c.err),
+		(*C.OraText)(unsafe.Pointer(pquery)),
+		C.ub4(len(s.sql)),
+		C.OCI_DEFAULT); rv != C.OCI_SUCCESS {
+		err = ociGetError(rv, s.c.err)
+	}
+	C.free(unsafe.Pointer(s.bp))
+	return err
+}
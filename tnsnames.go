@@ -0,0 +1,327 @@
+package oci8
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NVPair is a name-value pair of oracle net configuration, like the connect
+// descriptor (DESCRIPTION=(ADDRESS=(HOST=dbhost)(PORT=1521))). A pair has
+// either a Value or Children.
+type NVPair struct {
+	Name     string
+	Value    string
+	Children []*NVPair
+}
+
+// ParseNVPair parses the name-value pair s, e.g. a connect descriptor.
+func ParseNVPair(s string) (*NVPair, error) {
+	p := &nvParser{s: stripComments(s)}
+	p.skipSpace()
+	nv, err := p.pair()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.i < len(p.s) {
+		return nil, p.errorf("unexpected %q after %s", p.s[p.i], nv.Name)
+	}
+	return nv, nil
+}
+
+// Child returns the first child named name, case insensitive, or nil.
+func (nv *NVPair) Child(name string) *NVPair {
+	for _, c := range nv.Children {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// String returns nv in the syntax of tnsnames.ora, on one line.
+func (nv *NVPair) String() string {
+	var buf bytes.Buffer
+	nv.write(&buf)
+	return buf.String()
+}
+
+func (nv *NVPair) write(buf *bytes.Buffer) {
+	buf.WriteByte('(')
+	buf.WriteString(nv.Name)
+	buf.WriteByte('=')
+	if len(nv.Children) == 0 {
+		buf.WriteString(quoteNVValue(nv.Value))
+	}
+	for _, c := range nv.Children {
+		c.write(buf)
+	}
+	buf.WriteByte(')')
+}
+
+func quoteNVValue(v string) string {
+	if v == "" || strings.ContainsAny(v, "()=#\"' \t\r\n") {
+		if !strings.Contains(v, `"`) {
+			return `"` + v + `"`
+		}
+		return "'" + v + "'"
+	}
+	return v
+}
+
+// stripComments blanks # comments, which take the rest of a line starting
+// with #, after blanks. A # elsewhere is part of a value.
+func stripComments(s string) string {
+	b := []byte(s)
+	var quote byte
+	lineStart := true
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		start := lineStart
+		lineStart = c == '\n' || (lineStart && (c == ' ' || c == '\t' || c == '\r'))
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && start:
+			for ; i < len(b) && b[i] != '\n'; i++ {
+				b[i] = ' '
+			}
+			lineStart = true
+		}
+	}
+	return string(b)
+}
+
+type nvParser struct {
+	s    string
+	i    int
+	file string // for errors
+}
+
+func (p *nvParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	msg := fmt.Sprintf(format, args...)
+	if p.file != "" {
+		return fmt.Errorf("oci8: %s:%d: %s", p.file, line, msg)
+	}
+	return fmt.Errorf("oci8: line %d: %s", line, msg)
+}
+
+func (p *nvParser) skipSpace() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// pair parses (NAME=VALUE) or (NAME=(...)(...)).
+func (p *nvParser) pair() (*NVPair, error) {
+	if p.i >= len(p.s) || p.s[p.i] != '(' {
+		return nil, p.errorf("expected (")
+	}
+	p.i++
+	p.skipSpace()
+	name := p.token("=()")
+	if name == "" {
+		return nil, p.errorf("missing name")
+	}
+	if p.i >= len(p.s) || p.s[p.i] != '=' {
+		return nil, p.errorf("expected = after %s", name)
+	}
+	p.i++
+	p.skipSpace()
+
+	nv := &NVPair{Name: name}
+	if p.i < len(p.s) && p.s[p.i] == '(' {
+		for p.i < len(p.s) && p.s[p.i] == '(' {
+			c, err := p.pair()
+			if err != nil {
+				return nil, err
+			}
+			nv.Children = append(nv.Children, c)
+			p.skipSpace()
+		}
+	} else {
+		v, err := p.value(")")
+		if err != nil {
+			return nil, err
+		}
+		nv.Value = v
+	}
+	if p.i >= len(p.s) || p.s[p.i] != ')' {
+		return nil, p.errorf("missing ) of %s", name)
+	}
+	p.i++
+	return nv, nil
+}
+
+// token reads up to one of the delimiters, trimming spaces.
+func (p *nvParser) token(delims string) string {
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(delims, p.s[p.i]) < 0 {
+		p.i++
+	}
+	return strings.TrimSpace(p.s[start:p.i])
+}
+
+// value reads a maybe quoted value up to one of the delimiters.
+func (p *nvParser) value(delims string) (string, error) {
+	if p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\'') {
+		quote := p.s[p.i]
+		end := strings.IndexByte(p.s[p.i+1:], quote)
+		if end < 0 {
+			return "", p.errorf("unterminated quote")
+		}
+		v := p.s[p.i+1 : p.i+1+end]
+		p.i += end + 2
+		p.skipSpace()
+		return v, nil
+	}
+	v := p.token(delims)
+	if strings.ContainsAny(v, "=(") {
+		return "", p.errorf("invalid value %q", v)
+	}
+	return v, nil
+}
+
+// TNSNames holds the aliases of a tnsnames.ora file and the files it
+// includes with IFILE.
+type TNSNames struct {
+	Path    string
+	Entries map[string]*NVPair // connect descriptors by upper case alias
+}
+
+// ReadTNSNames reads the tnsnames.ora file path. An alias defined twice
+// resolves to its last definition.
+func ReadTNSNames(path string) (*TNSNames, error) {
+	t := &TNSNames{Path: path, Entries: map[string]*NVPair{}}
+	if err := t.read(path, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TNSNames) read(path string, seen map[string]bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if seen[abs] {
+		return fmt.Errorf("oci8: %s includes itself", path)
+	}
+	seen[abs] = true
+	defer delete(seen, abs)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	p := &nvParser{s: stripComments(string(b)), file: path}
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return nil
+		}
+		names := p.token("=()")
+		if names == "" || p.i >= len(p.s) || p.s[p.i] != '=' {
+			return p.errorf("expected alias =")
+		}
+		p.i++
+		p.skipSpace()
+
+		if strings.EqualFold(names, "IFILE") {
+			v, err := p.value(" \t\r\n")
+			if err != nil {
+				return err
+			}
+			if !filepath.IsAbs(v) {
+				v = filepath.Join(filepath.Dir(path), v)
+			}
+			if err := t.read(v, seen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var pairs []*NVPair
+		for p.i < len(p.s) && p.s[p.i] == '(' {
+			nv, err := p.pair()
+			if err != nil {
+				return err
+			}
+			pairs = append(pairs, nv)
+			p.skipSpace()
+		}
+		if len(pairs) == 0 {
+			return p.errorf("expected connect descriptor for %s", names)
+		}
+		desc := pairs[0]
+		if len(pairs) > 1 || (!strings.EqualFold(desc.Name, "DESCRIPTION") && !strings.EqualFold(desc.Name, "DESCRIPTION_LIST")) {
+			// alias = (ADDRESS=...)(CONNECT_DATA=...)
+			desc = &NVPair{Name: "DESCRIPTION", Children: pairs}
+		}
+		for _, name := range strings.Split(names, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				t.Entries[strings.ToUpper(name)] = desc
+			}
+		}
+	}
+}
+
+// Lookup returns the connect descriptor of alias, case insensitive.
+func (t *TNSNames) Lookup(alias string) (*NVPair, error) {
+	if nv, ok := t.Entries[strings.ToUpper(alias)]; ok {
+		return nv, nil
+	}
+	return nil, fmt.Errorf("alias %s not found in %s", alias, t.Path)
+}
+
+// Aliases returns the sorted aliases.
+func (t *TNSNames) Aliases() []string {
+	aliases := make([]string, 0, len(t.Entries))
+	for alias := range t.Entries {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// TNSNamesPath returns the path of tnsnames.ora in the directory tnsAdmin,
+// or when empty in $TNS_ADMIN or $ORACLE_HOME/network/admin.
+func TNSNamesPath(tnsAdmin string) (string, error) {
+	if tnsAdmin == "" {
+		tnsAdmin = os.Getenv("TNS_ADMIN")
+	}
+	if tnsAdmin == "" {
+		if home := os.Getenv("ORACLE_HOME"); home != "" {
+			tnsAdmin = filepath.Join(home, "network", "admin")
+		}
+	}
+	if tnsAdmin == "" {
+		return "", errors.New("oci8: neither TNS_ADMIN nor ORACLE_HOME is set")
+	}
+	return filepath.Join(tnsAdmin, "tnsnames.ora"), nil
+}
+
+// ResolveTNSAlias returns the connect descriptor of alias in the
+// tnsnames.ora of the directory tnsAdmin, see TNSNamesPath.
+func ResolveTNSAlias(alias, tnsAdmin string) (*NVPair, error) {
+	path, err := TNSNamesPath(tnsAdmin)
+	if err != nil {
+		return nil, err
+	}
+	t, err := ReadTNSNames(path)
+	if err != nil {
+		return nil, err
+	}
+	return t.Lookup(alias)
+}
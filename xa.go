@@ -0,0 +1,273 @@
+package oci8
+
+/*
+#include <oci.h>
+#include <string.h>
+
+typedef struct {
+  OCITrans *th;
+  sword rv;
+} retTrans;
+
+// WrapOCITransXID allocates a transaction handle identified by the xid and
+// sets it on the service context.
+static retTrans
+WrapOCITransXID(OCIEnv *env, OCISvcCtx *svc, OCIError *err, long format, char *gtrid, long glen, char *bqual, long blen) {
+  retTrans vvv = {NULL, 0};
+  XID xid;
+  vvv.rv = OCIHandleAlloc(env, (dvoid**)&vvv.th, OCI_HTYPE_TRANS, 0, NULL);
+  if (vvv.rv != OCI_SUCCESS) {
+    return vvv;
+  }
+  xid.formatID = format;
+  xid.gtrid_length = glen;
+  xid.bqual_length = blen;
+  memcpy(xid.data, gtrid, glen);
+  memcpy(xid.data + glen, bqual, blen);
+  vvv.rv = OCIAttrSet(vvv.th, OCI_HTYPE_TRANS, &xid, sizeof(XID), OCI_ATTR_XID, err);
+  if (vvv.rv == OCI_SUCCESS) {
+    vvv.rv = OCIAttrSet(svc, OCI_HTYPE_SVCCTX, vvv.th, 0, OCI_ATTR_TRANS, err);
+  }
+  if (vvv.rv != OCI_SUCCESS) {
+    OCIHandleFree(vvv.th, OCI_HTYPE_TRANS);
+    vvv.th = NULL;
+  }
+  return vvv;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/net/context"
+)
+
+// XID identifies a branch of a distributed transaction, as in the X/Open XA
+// specification.
+type XID struct {
+	FormatID            int64
+	GlobalTransactionID []byte // at most 64 bytes
+	BranchQualifier     []byte // at most 64 bytes
+}
+
+func (xid *XID) validate() error {
+	if len(xid.GlobalTransactionID) == 0 || len(xid.GlobalTransactionID) > C.MAXGTRIDSIZE {
+		return errors.New("oci8: XID global transaction id must be 1 to 64 bytes")
+	}
+	if len(xid.BranchQualifier) > C.MAXBQUALSIZE {
+		return errors.New("oci8: XID branch qualifier must be at most 64 bytes")
+	}
+	return nil
+}
+
+// XAStart starts the distributed transaction branch xid on the connection.
+// timeout is how long the branch may stay detached before oracle rolls it
+// back. Oracle counts it in whole seconds, so it is rounded up to the next
+// second.
+//
+// The XA methods are available through sql.Conn.Raw. Statements executed
+// on the connection between XAStart and XAEnd are part of the branch. Like
+// the other round trips, the XA calls are cancelled when ctx is done and
+// limited by its deadline and the call_timeout DSN parameter.
+func (c *OCI8Conn) XAStart(ctx context.Context, xid XID, timeout time.Duration) error {
+	return c.xaStart(ctx, xid, timeout, C.OCI_TRANS_NEW)
+}
+
+// XAResume attaches the connection to the branch xid, detached by XAEnd,
+// maybe on another connection.
+func (c *OCI8Conn) XAResume(ctx context.Context, xid XID, timeout time.Duration) error {
+	return c.xaStart(ctx, xid, timeout, C.OCI_TRANS_RESUME)
+}
+
+func (c *OCI8Conn) xaStart(ctx context.Context, xid XID, timeout time.Duration, flags C.ub4) error {
+	if c.inTransaction {
+		return errors.New("oci8: transaction already in progress")
+	}
+	seconds, err := xaTimeout(timeout)
+	if err != nil {
+		return err
+	}
+	cl, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
+	if err = c.xaTrans(xid); err != nil {
+		return cl.finish(err)
+	}
+	if rv := C.OCITransStart(
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCIError)(c.err),
+		seconds,
+		flags); rv != C.OCI_SUCCESS {
+		err = c.timeoutError(ociGetError(rv, c.err))
+		c.xaRelease()
+	}
+	if err = cl.finish(err); err != nil {
+		return err
+	}
+	c.inTransaction = true
+	return nil
+}
+
+// xaTimeout converts the timeout of a branch to the whole seconds of
+// OCITransStart, rounding up.
+func xaTimeout(timeout time.Duration) (C.uword, error) {
+	if timeout < 0 {
+		return 0, fmt.Errorf("oci8: negative XA timeout %v", timeout)
+	}
+	seconds := timeout / time.Second
+	if timeout%time.Second != 0 {
+		seconds++
+	}
+	if uint64(seconds) > uint64(^C.uword(0)) {
+		return 0, fmt.Errorf("oci8: XA timeout %v is too long", timeout)
+	}
+	return C.uword(seconds), nil
+}
+
+// XAEnd detaches the connection from its branch. The branch may then be
+// resumed, prepared, committed or rolled back from any connection.
+func (c *OCI8Conn) XAEnd(ctx context.Context) error {
+	if c.xa == nil {
+		return errors.New("oci8: no XA transaction branch attached")
+	}
+	cl, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
+	if rv := C.OCITransDetach(
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCIError)(c.err),
+		C.OCI_DEFAULT); rv != C.OCI_SUCCESS {
+		err = c.timeoutError(ociGetError(rv, c.err))
+	} else {
+		c.xaRelease()
+	}
+	if err = cl.finish(err); err != nil {
+		return err
+	}
+	c.inTransaction = false
+	c.savepoints = nil
+	return nil
+}
+
+// XAPrepare prepares the branch xid for commit. It reports readOnly when
+// the branch made no changes, such a branch needs no XACommit.
+func (c *OCI8Conn) XAPrepare(ctx context.Context, xid XID) (readOnly bool, err error) {
+	err = c.xaCall(ctx, xid, func() C.sword {
+		rv := C.OCITransPrepare(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			C.OCI_DEFAULT)
+		if rv == C.OCI_SUCCESS_WITH_INFO {
+			// ORA-24767: transaction branch prepare returns read-only
+			readOnly = true
+			return C.OCI_SUCCESS
+		}
+		return rv
+	})
+	return readOnly, err
+}
+
+// XACommit commits the branch xid. Unless onePhase is set, the branch must
+// have been prepared by XAPrepare.
+func (c *OCI8Conn) XACommit(ctx context.Context, xid XID, onePhase bool) error {
+	var flags C.ub4 = C.OCI_TRANS_TWOPHASE
+	if onePhase {
+		flags = C.OCI_DEFAULT
+	}
+	return c.xaCall(ctx, xid, func() C.sword {
+		return C.OCITransCommit(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			flags)
+	})
+}
+
+// XARollback rolls back the branch xid.
+func (c *OCI8Conn) XARollback(ctx context.Context, xid XID) error {
+	return c.xaCall(ctx, xid, func() C.sword {
+		return C.OCITransRollback(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			C.OCI_DEFAULT)
+	})
+}
+
+// XAForget makes oracle forget the heuristically completed branch xid.
+func (c *OCI8Conn) XAForget(ctx context.Context, xid XID) error {
+	return c.xaCall(ctx, xid, func() C.sword {
+		return C.OCITransForget(
+			(*C.OCISvcCtx)(c.svc),
+			(*C.OCIError)(c.err),
+			C.OCI_DEFAULT)
+	})
+}
+
+// xaCall runs the round trip f on the branch xid, as a call of ctx, and
+// releases the transaction handle of xid after it.
+func (c *OCI8Conn) xaCall(ctx context.Context, xid XID, f func() C.sword) error {
+	cl, err := c.startCall(ctx)
+	if err != nil {
+		return err
+	}
+	if err = c.xaTrans(xid); err != nil {
+		return cl.finish(err)
+	}
+	if rv := f(); rv != C.OCI_SUCCESS {
+		err = c.timeoutError(ociGetError(rv, c.err))
+	}
+	c.xaRelease()
+	return cl.finish(err)
+}
+
+// xaTrans sets a transaction handle for xid on the service context,
+// releasing the one of the previous XA call.
+func (c *OCI8Conn) xaTrans(xid XID) error {
+	if err := xid.validate(); err != nil {
+		return err
+	}
+	var bqual *C.char
+	if len(xid.BranchQualifier) > 0 {
+		bqual = (*C.char)(unsafe.Pointer(&xid.BranchQualifier[0]))
+	}
+	ret := C.WrapOCITransXID(
+		(*C.OCIEnv)(c.env),
+		(*C.OCISvcCtx)(c.svc),
+		(*C.OCIError)(c.err),
+		C.long(xid.FormatID),
+		(*C.char)(unsafe.Pointer(&xid.GlobalTransactionID[0])),
+		C.long(len(xid.GlobalTransactionID)),
+		bqual,
+		C.long(len(xid.BranchQualifier)))
+	if ret.rv != C.OCI_SUCCESS {
+		return ociGetError(ret.rv, c.err)
+	}
+	if c.xa != nil {
+		C.OCIHandleFree(unsafe.Pointer(c.xa), C.OCI_HTYPE_TRANS)
+	}
+	c.xa = ret.th
+	return nil
+}
+
+// xaRelease takes the transaction handle of the last XA call off the
+// service context and frees it, so that later local transactions don't run
+// in the ended branch.
+func (c *OCI8Conn) xaRelease() {
+	if c.xa == nil {
+		return
+	}
+	C.OCIAttrSet(
+		c.svc,
+		C.OCI_HTYPE_SVCCTX,
+		nil,
+		0,
+		C.OCI_ATTR_TRANS,
+		(*C.OCIError)(c.err))
+	C.OCIHandleFree(unsafe.Pointer(c.xa), C.OCI_HTYPE_TRANS)
+	c.xa = nil
+}